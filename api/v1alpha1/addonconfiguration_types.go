@@ -0,0 +1,157 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type SecretNamingSpec struct {
+	// Template of the kubeConfig Secret name, created in the ServiceAccount Namespace.
+	// The {name} placeholder is replaced with the ServiceAccount name.
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	NameTemplate string `json:"nameTemplate,omitempty"`
+	// Key of the kubeConfig in the Secret.
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=users;serviceaccounts;groups
+type ImpersonatorResource string
+
+type ImpersonatorSpec struct {
+	// Resources the ServiceAccounts are granted the impersonation of their own identity on, with the impersonator
+	// ClusterRole: the username, the ServiceAccount, and the ServiceAccount groups.
+	// +kubebuilder:validation:MinItems=1
+	// +listType=set
+	Resources []ImpersonatorResource `json:"resources"`
+}
+
+type NotificationSpec struct {
+	// Type of the Flux notification Provider, such as generic, slack or msteams.
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	ProviderType string `json:"providerType,omitempty"`
+	// Severity of the events notified.
+	// +kubebuilder:validation:Enum=info;error
+	// +optional
+	EventSeverity string `json:"eventSeverity,omitempty"`
+	// Annotation of the Tenant holding the address of the notification Provider: the Provider and the Alert are
+	// generated only for the Tenants having it.
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	AddressAnnotation string `json:"addressAnnotation,omitempty"`
+}
+
+// AddonDefaults are the settings of the credentials, applied unless specified by the FluxTenantCredential.
+type AddonDefaults struct {
+	// Way Flux reconciles the Tenant resources as the ServiceAccounts.
+	// +optional
+	Mode Mode `json:"mode,omitempty"`
+	// Capsule Proxy endpoint settings.
+	// +optional
+	Proxy *ProxySpec `json:"proxy,omitempty"`
+	// Policy of the token set in the kubeConfig.
+	// +optional
+	TokenPolicy *TokenPolicySpec `json:"tokenPolicy,omitempty"`
+	// RBAC settings of the ServiceAccounts.
+	// +optional
+	RBAC *RBACSpec `json:"rbac,omitempty"`
+	// Impersonator ClusterRole of the ServiceAccounts.
+	// +optional
+	Impersonator *ImpersonatorSpec `json:"impersonator,omitempty"`
+	// Naming of the kubeConfig Secrets.
+	// +optional
+	Secret *SecretNamingSpec `json:"secret,omitempty"`
+	// Notification of the failures of the Kustomizations in the ServiceAccounts Namespaces.
+	// +optional
+	Notification *NotificationSpec `json:"notification,omitempty"`
+}
+
+type AllowedTenantsSpec struct {
+	// Names of the Tenants allowed.
+	// +optional
+	Names []string `json:"names,omitempty"`
+	// Selector of the Tenants allowed.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+}
+
+// TenantOverride are the settings of the credentials of the ServiceAccounts placed in the Namespace of a Tenant
+// matching the selector.
+type TenantOverride struct {
+	// Selector of the Tenants the override applies to.
+	TenantSelector metav1.LabelSelector `json:"tenantSelector"`
+
+	AddonDefaults `json:",inline"`
+}
+
+// AddonConfigurationSpec defines the desired state of AddonConfiguration.
+type AddonConfigurationSpec struct {
+	AddonDefaults `json:",inline"`
+
+	// Tenants credentials can be issued for.
+	// Defaults to all the Tenants.
+	// +optional
+	AllowedTenants *AllowedTenantsSpec `json:"allowedTenants,omitempty"`
+	// Capsule Proxy URLs the FluxTenantCredentials can set as server of the kubeConfig, on top of the one configured
+	// at addon-level.
+	// +listType=set
+	// +optional
+	AllowedProxyURLs []string `json:"allowedProxyURLs,omitempty"`
+	// Overrides of the defaults for the Tenants matching a selector: the first override matching the Tenant of the
+	// ServiceAccount Namespace applies.
+	// +optional
+	Overrides []TenantOverride `json:"overrides,omitempty"`
+}
+
+// AddonConfigurationStatus defines the observed state of AddonConfiguration.
+type AddonConfigurationStatus struct {
+	// The generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Whether the configuration is the one in use by the addon.
+	// +optional
+	Active bool `json:"active,omitempty"`
+	// Conditions of the configuration.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// The last valid specification of the configuration, in use by the addon while the current one is not
+	// validated.
+	// +optional
+	ValidatedSpec *AddonConfigurationSpec `json:"validatedSpec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:printcolumn:name="Active",type="boolean",JSONPath=".status.active",description="Whether the configuration is in use"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="The validity of the configuration"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="Age"
+
+// AddonConfiguration is the Schema for the addonconfigurations API.
+// It defines the platform defaults of the credentials issued by the addon: only the configuration of which the name
+// is selected at manager-level is in use.
+type AddonConfiguration struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AddonConfigurationSpec   `json:"spec,omitempty"`
+	Status AddonConfigurationStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// AddonConfigurationList contains a list of AddonConfiguration.
+type AddonConfigurationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AddonConfiguration `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AddonConfiguration{}, &AddonConfigurationList{})
+}
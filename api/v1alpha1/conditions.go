@@ -0,0 +1,39 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+const (
+	// ReadyCondition reports whether the credential has been issued, or the configuration is valid.
+	ReadyCondition = "Ready"
+
+	IssuedReason                 = "Issued"
+	ServiceAccountNotFoundReason = "ServiceAccountNotFound"
+	NotTenantOwnerReason         = "NotTenantOwner"
+	TokenPendingReason           = "TokenPending"
+	ConfigurationPendingReason   = "ConfigurationPending"
+	ProxyURLNotAllowedReason     = "ProxyURLNotAllowed"
+	ConflictReason               = "Conflict"
+	FailedReason                 = "Failed"
+
+	// ProxyVerifiedCondition reports whether the kubeConfig has been verified against the Capsule Proxy, when the
+	// verification is enabled.
+	ProxyVerifiedCondition = "ProxyVerified"
+
+	VerifiedReason                = "Verified"
+	ProxyVerificationFailedReason = "ProxyVerificationFailed"
+
+	// PausedCondition reports whether the reconciliation of the credential is paused.
+	PausedCondition = "Paused"
+
+	PausedReason = "Paused"
+)
+
+const (
+	// ActiveReason reports the AddonConfiguration is valid and in use.
+	ActiveReason = "Active"
+	// InactiveReason reports the AddonConfiguration is valid, but not selected at manager-level.
+	InactiveReason = "Inactive"
+	// InvalidReason reports the AddonConfiguration is not valid, and is ignored.
+	InvalidReason = "Invalid"
+)
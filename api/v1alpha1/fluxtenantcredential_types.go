@@ -0,0 +1,271 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +kubebuilder:validation:Enum=ServiceAccountToken;TokenRequest
+type TokenType string
+
+const (
+	// ServiceAccountTokenType uses a long-lived token Secret of type kubernetes.io/service-account-token.
+	ServiceAccountTokenType TokenType = "ServiceAccountToken"
+	// TokenRequestType uses a bound token issued with the TokenRequest API, rotated before its expiration.
+	TokenRequestType TokenType = "TokenRequest"
+)
+
+// +kubebuilder:validation:Enum=Kubeconfig;Impersonation
+type Mode string
+
+const (
+	// KubeconfigMode makes Flux reconcile the Tenant resources through the Capsule Proxy with the kubeConfig.
+	KubeconfigMode Mode = "Kubeconfig"
+	// ImpersonationMode makes Flux reconcile the Tenant resources impersonating the ServiceAccount, set as the
+	// serviceAccountName of the Flux objects, without the Capsule Proxy.
+	ImpersonationMode Mode = "Impersonation"
+)
+
+// +kubebuilder:validation:Enum=None;GlobalTenantResource;TenantResource
+type DistributionKind string
+
+const (
+	NoDistribution                   DistributionKind = "None"
+	GlobalTenantResourceDistribution DistributionKind = "GlobalTenantResource"
+	TenantResourceDistribution       DistributionKind = "TenantResource"
+)
+
+type ProxySpec struct {
+	// URL of the Capsule Proxy set as server of the kubeConfig.
+	// Defaults to the URL configured at addon-level.
+	// +optional
+	URL string `json:"url,omitempty"`
+}
+
+type TokenPolicySpec struct {
+	// Type of the token set in the kubeConfig.
+	// Defaults to the type configured at addon-level.
+	// +optional
+	Type TokenType `json:"type,omitempty"`
+	// Lifetime of the tokens issued with the TokenRequest API.
+	// The token is rotated when 80% of its lifetime has elapsed.
+	// Defaults to the lifetime configured at addon-level, if any, or to 86400 seconds.
+	// +kubebuilder:validation:Minimum=600
+	// +optional
+	ExpirationSeconds *int64 `json:"expirationSeconds,omitempty"`
+}
+
+type RBACSpec struct {
+	// Name of the ClusterRole bound to the ServiceAccount in its Namespace.
+	// Defaults to the ClusterRole configured at addon-level.
+	// +optional
+	ClusterRoleName string `json:"clusterRoleName,omitempty"`
+}
+
+type SecretSpec struct {
+	// Name of the kubeConfig Secret, created in the ServiceAccount Namespace.
+	// Defaults to the ServiceAccount name with the -kubeconfig suffix.
+	// +optional
+	Name string `json:"name,omitempty"`
+	// Key of the kubeConfig in the Secret.
+	// Defaults to the key configured at addon-level.
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+type DistributionSpec struct {
+	// Capsule resource used to distribute the kubeConfig Secret across the Tenant Namespaces.
+	// Defaults to None.
+	// +optional
+	Kind DistributionKind `json:"kind,omitempty"`
+	// Names of the Tenants to distribute the kubeConfig Secret to.
+	// Defaults to all the Tenants served by the credential.
+	// +optional
+	Tenants []string `json:"tenants,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=GitRepository;OCIRepository;Bucket
+type BootstrapSourceKind string
+
+const (
+	GitRepositorySource BootstrapSourceKind = "GitRepository"
+	OCIRepositorySource BootstrapSourceKind = "OCIRepository"
+	BucketSource        BootstrapSourceKind = "Bucket"
+)
+
+type BucketSpec struct {
+	// Name of the bucket.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// Endpoint of the bucket storage, without scheme.
+	// +kubebuilder:validation:MinLength=1
+	Endpoint string `json:"endpoint"`
+	// Provider of the bucket storage.
+	// +kubebuilder:validation:Enum=generic;aws;gcp;azure
+	// +kubebuilder:default=generic
+	// +optional
+	Provider string `json:"provider,omitempty"`
+	// Region of the bucket.
+	// +optional
+	Region string `json:"region,omitempty"`
+}
+
+type OIDCIdentityMatch struct {
+	// Regular expression matching the OIDC issuer of the keyless signatures.
+	Issuer string `json:"issuer"`
+	// Regular expression matching the identity of the keyless signatures.
+	Subject string `json:"subject"`
+}
+
+type VerificationSpec struct {
+	// Provider of the OCI artifacts signatures.
+	// +kubebuilder:validation:Enum=cosign;notation
+	// +optional
+	Provider string `json:"provider,omitempty"`
+	// Mode of the Git commits verification.
+	// +kubebuilder:validation:Enum=HEAD;Tag;TagAndHEAD
+	// +optional
+	Mode string `json:"mode,omitempty"`
+	// Secret, in the credential Namespace, holding the trusted public keys.
+	// Required for Git sources, while keyless verification is used for OCI sources when not specified.
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+	// OIDC identities the keyless cosign signatures must match.
+	// +optional
+	MatchOIDCIdentity []OIDCIdentityMatch `json:"matchOIDCIdentity,omitempty"`
+}
+
+// +kubebuilder:validation:XValidation:rule="self.sourceKind == 'Bucket' ? has(self.bucket) : has(self.url)",message="url is required for GitRepository and OCIRepository sources, bucket for Bucket sources"
+// +kubebuilder:validation:XValidation:rule="!has(self.verify) || self.sourceKind != 'Bucket'",message="verify is not supported by Bucket sources"
+// +kubebuilder:validation:XValidation:rule="!has(self.verify) || self.sourceKind != 'OCIRepository' || has(self.verify.provider)",message="verify.provider is required for OCIRepository sources"
+// +kubebuilder:validation:XValidation:rule="!has(self.verify) || self.sourceKind != 'GitRepository' || (has(self.verify.mode) && has(self.verify.secretRef))",message="verify.mode and verify.secretRef are required for GitRepository sources"
+type BootstrapSpec struct {
+	// Kind of the Flux source.
+	// +kubebuilder:default=GitRepository
+	// +optional
+	SourceKind BootstrapSourceKind `json:"sourceKind,omitempty"`
+	// URL of the Git repository, or of the OCI artifact.
+	// +kubebuilder:validation:Pattern="^(http|https|ssh|oci)://.*$"
+	// +optional
+	URL string `json:"url,omitempty"`
+	// Branch of the Git repository.
+	// +kubebuilder:default=main
+	// +optional
+	Branch string `json:"branch,omitempty"`
+	// Tag of the OCI artifact.
+	// +kubebuilder:default=latest
+	// +optional
+	Tag string `json:"tag,omitempty"`
+	// Bucket the manifests are fetched from.
+	// +optional
+	Bucket *BucketSpec `json:"bucket,omitempty"`
+	// Path of the Kustomization, relative to the source root.
+	// +kubebuilder:default="./"
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Secret, in the credential Namespace, holding the source credentials.
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+	// Verification of the Git commits, or of the OCI artifacts signatures.
+	// +optional
+	Verify *VerificationSpec `json:"verify,omitempty"`
+	// Interval of the Kustomization reconciliation.
+	// +kubebuilder:default="10m"
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// FluxTenantCredentialSpec defines the desired state of FluxTenantCredential.
+type FluxTenantCredentialSpec struct {
+	// Name of the ServiceAccount, in the same Namespace, the credential is issued for.
+	// The ServiceAccount must be a Tenant owner.
+	// +kubebuilder:validation:MinLength=1
+	ServiceAccountName string `json:"serviceAccountName"`
+	// Name of the Tenant served by the credential.
+	// Defaults to all the Tenants owned by the ServiceAccount.
+	// +optional
+	Tenant string `json:"tenant,omitempty"`
+	// Way Flux reconciles the Tenant resources as the ServiceAccount.
+	// In the Impersonation mode, the kubeConfig is not issued, and the Flux controllers are granted the impersonation
+	// of the ServiceAccount.
+	// Defaults to the mode configured at addon-level.
+	// +optional
+	Mode Mode `json:"mode,omitempty"`
+	// Capsule Proxy endpoint settings.
+	// The URL must be allowed by the AddonConfiguration in use, unless it's the one configured at addon-level.
+	// +optional
+	Proxy *ProxySpec `json:"proxy,omitempty"`
+	// Policy of the token set in the kubeConfig.
+	// +optional
+	TokenPolicy *TokenPolicySpec `json:"tokenPolicy,omitempty"`
+	// RBAC settings of the ServiceAccount.
+	// +optional
+	RBAC *RBACSpec `json:"rbac,omitempty"`
+	// Layout of the kubeConfig Secret.
+	// +optional
+	Secret *SecretSpec `json:"secret,omitempty"`
+	// Distribution of the kubeConfig Secret across the Tenant Namespaces.
+	// +optional
+	Distribution *DistributionSpec `json:"distribution,omitempty"`
+	// Source the Flux source and Kustomization, named after the ServiceAccount and using the kubeConfig, are
+	// bootstrapped from.
+	// +optional
+	Bootstrap *BootstrapSpec `json:"bootstrap,omitempty"`
+}
+
+// FluxTenantCredentialStatus defines the observed state of FluxTenantCredential.
+type FluxTenantCredentialStatus struct {
+	// The generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Conditions of the credential.
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// Name of the kubeConfig Secret.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+	// Expiration of the token set in the kubeConfig, when issued with the TokenRequest API.
+	// +optional
+	TokenExpirationTimestamp *metav1.Time `json:"tokenExpirationTimestamp,omitempty"`
+	// Tenants served by the credential.
+	// +optional
+	Tenants []string `json:"tenants,omitempty"`
+	// Namespaces the kubeConfig Secret has been distributed to.
+	// +optional
+	DistributedNamespaces []string `json:"distributedNamespaces,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=ftc
+// +kubebuilder:printcolumn:name="ServiceAccount",type="string",JSONPath=".spec.serviceAccountName",description="The ServiceAccount the credential is issued for"
+// +kubebuilder:printcolumn:name="Secret",type="string",JSONPath=".status.secretName",description="The kubeConfig Secret"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="The readiness of the credential"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="Age"
+
+// FluxTenantCredential is the Schema for the fluxtenantcredentials API.
+// It issues the kubeConfig used by Flux to reconcile the resources of a Tenant as its ServiceAccount owner, through
+// the Capsule Proxy.
+type FluxTenantCredential struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   FluxTenantCredentialSpec   `json:"spec,omitempty"`
+	Status FluxTenantCredentialStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// FluxTenantCredentialList contains a list of FluxTenantCredential.
+type FluxTenantCredentialList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []FluxTenantCredential `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&FluxTenantCredential{}, &FluxTenantCredentialList{})
+}
@@ -0,0 +1,168 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package audit
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/util/duration"
+
+	"github.com/projectcapsule/capsule-addon-flux/pkg/cli"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/serviceaccount"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputCSV   = "csv"
+)
+
+type Options struct {
+	cli.Options
+
+	Output      string
+	OrphansOnly bool
+}
+
+func New() *cobra.Command {
+	opts := &Options{Options: cli.Options{WithoutProxy: true}}
+
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Lists the credentials issued by the Capsule addon for FluxCD, flagging the orphaned ones",
+		Args:  cobra.NoArgs,
+		RunE:  opts.Run,
+	}
+
+	opts.AddFlags(cmd)
+
+	cmd.Flags().StringVarP(&opts.Output, "output", "o", OutputTable, fmt.Sprintf("Format of the report, one of %s, %s or %s", OutputTable, OutputJSON, OutputCSV))
+	cmd.Flags().BoolVar(&opts.OrphansOnly, "orphans-only", false, "List only the orphaned credentials")
+
+	return cmd
+}
+
+func (o *Options) Run(cmd *cobra.Command, _ []string) error {
+	if o.Output != OutputTable && o.Output != OutputJSON && o.Output != OutputCSV {
+		return errors.Errorf("invalid output %q, expected %s, %s or %s", o.Output, OutputTable, OutputJSON, OutputCSV)
+	}
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	addon, err := o.Start(ctx)
+	if err != nil {
+		return err
+	}
+
+	records, err := addon.Issuer.Audit(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to audit the credentials")
+	}
+
+	if o.OrphansOnly {
+		orphans := make([]serviceaccount.AuditRecord, 0, len(records))
+
+		for _, record := range records {
+			if record.Orphan != "" {
+				orphans = append(orphans, record)
+			}
+		}
+
+		records = orphans
+	}
+
+	switch o.Output {
+	case OutputJSON:
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(records)
+	case OutputCSV:
+		return writeCSV(cmd.OutOrStdout(), records)
+	default:
+		return writeTable(cmd.OutOrStdout(), records)
+	}
+}
+
+// columns returns the header of the report, with the column of the creation time specified.
+func columns(created string) []string {
+	return []string{"SERVICEACCOUNT", "TENANT", "KIND", "NAMESPACE", "NAME", created, "TOKEN EXPIRATION", "DISTRIBUTED TO", "ORPHAN"}
+}
+
+// row returns the columns of the record, with its creation time formatted as specified.
+func row(record serviceaccount.AuditRecord, created func(time.Time) string) []string {
+	expiration := "never"
+	if record.TokenExpiration != nil {
+		expiration = record.TokenExpiration.Format(time.RFC3339)
+	}
+
+	if record.Kind != "Secret" {
+		expiration = ""
+	}
+
+	return []string{
+		record.ServiceAccount,
+		record.Tenant,
+		record.Kind,
+		record.Namespace,
+		record.Name,
+		created(record.Created),
+		expiration,
+		strings.Join(record.DistributedTo, " "),
+		record.Orphan,
+	}
+}
+
+func writeTable(w io.Writer, records []serviceaccount.AuditRecord) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0) //nolint:mnd
+
+	now := time.Now()
+	age := func(created time.Time) string {
+		return duration.HumanDuration(now.Sub(created))
+	}
+
+	if _, err := fmt.Fprintln(tw, strings.Join(columns("AGE"), "\t")); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if _, err := fmt.Fprintln(tw, strings.Join(row(record, age), "\t")); err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
+
+func writeCSV(w io.Writer, records []serviceaccount.AuditRecord) error {
+	cw := csv.NewWriter(w)
+
+	timestamp := func(created time.Time) string {
+		return created.Format(time.RFC3339)
+	}
+
+	if err := cw.Write(columns("CREATED")); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if err := cw.Write(row(record, timestamp)); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+
+	return cw.Error()
+}
@@ -0,0 +1,137 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cleanup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/projectcapsule/capsule-addon-flux/pkg/cli"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/serviceaccount"
+)
+
+type Options struct {
+	cli.Options
+
+	All            bool
+	Tenant         string
+	Namespace      string
+	ServiceAccount string
+	DryRun         bool
+}
+
+func New() *cobra.Command {
+	opts := &Options{Options: cli.Options{WithoutProxy: true}}
+
+	cmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "Deletes the objects generated by the Capsule addon for FluxCD, for uninstall or migration",
+		Args:  cobra.NoArgs,
+		RunE:  opts.Run,
+	}
+
+	opts.AddFlags(cmd)
+
+	cmd.Flags().BoolVar(&opts.All, "all", false, "Delete the objects generated for all the ServiceAccounts")
+	cmd.Flags().StringVar(&opts.Tenant, "tenant", "", "Delete the objects generated for the Tenant specified")
+	cmd.Flags().StringVarP(&opts.Namespace, "namespace", "n", "", "Namespace of the ServiceAccount the objects have been generated for")
+	cmd.Flags().StringVar(&opts.ServiceAccount, "serviceaccount", "", "Delete the objects generated for the ServiceAccount specified")
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "Print the objects that would be deleted, without deleting them")
+
+	cmd.MarkFlagsMutuallyExclusive("all", "tenant", "serviceaccount")
+	cmd.MarkFlagsOneRequired("all", "tenant", "serviceaccount")
+	cmd.MarkFlagsRequiredTogether("namespace", "serviceaccount")
+
+	return cmd
+}
+
+func (o *Options) Run(cmd *cobra.Command, _ []string) error {
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	addon, err := o.Start(ctx)
+	if err != nil {
+		return err
+	}
+
+	var objs []client.Object
+
+	switch {
+	case o.ServiceAccount != "":
+		objs, err = addon.Issuer.Generated(ctx, o.Namespace, o.ServiceAccount)
+	case o.Tenant != "":
+		objs, err = addon.Issuer.Managed(ctx, map[string]string{serviceaccount.LabelTenant: o.Tenant})
+	default:
+		objs, err = addon.Issuer.Managed(ctx, nil)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "unable to list the generated objects")
+	}
+
+	// Delete the distribution first, to stop the copies of the kubeConfig Secrets.
+	sort.SliceStable(objs, func(i, j int) bool {
+		return isDistribution(objs[i]) && !isDistribution(objs[j])
+	})
+
+	for _, obj := range objs {
+		if err = o.delete(ctx, cmd.OutOrStdout(), addon.Client, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// delete deletes the object specified, if still the one generated by the addon, printing the outcome.
+func (o *Options) delete(ctx context.Context, w io.Writer, c client.Client, obj client.Object) error {
+	name := obj.GetName()
+	if obj.GetNamespace() != "" {
+		name = obj.GetNamespace() + "/" + name
+	}
+
+	description := fmt.Sprintf("%s %s", obj.GetObjectKind().GroupVersionKind().Kind, name)
+
+	// Safety check: only the objects labelled by the addon are deleted.
+	if obj.GetLabels()[serviceaccount.LabelManagedBy] != serviceaccount.ManagerName {
+		_, err := fmt.Fprintf(w, "skipped %s: not managed by %s\n", description, serviceaccount.ManagerName)
+
+		return err
+	}
+
+	if o.DryRun {
+		_, err := fmt.Fprintf(w, "%s would be deleted\n", description)
+
+		return err
+	}
+
+	// The UID precondition prevents the deletion of an object replaced in the meantime.
+	uid := obj.GetUID()
+	if err := c.Delete(ctx, obj, client.Preconditions{UID: &uid}, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+
+		return errors.Wrapf(err, "unable to delete %s", description)
+	}
+
+	_, err := fmt.Fprintf(w, "%s deleted\n", description)
+
+	return err
+}
+
+// isDistribution returns true if the object distributes the kubeConfig Secret across the Tenant Namespaces.
+func isDistribution(obj client.Object) bool {
+	kind := obj.GetObjectKind().GroupVersionKind().Kind
+
+	return kind == "GlobalTenantResource" || kind == "TenantResource"
+}
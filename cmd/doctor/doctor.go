@@ -0,0 +1,168 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/cli"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/serviceaccount"
+)
+
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+type Options struct {
+	cli.Options
+
+	Namespace      string
+	ServiceAccount string
+	Output         string
+}
+
+func New() *cobra.Command {
+	opts := new(Options)
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Diagnoses the GitOps setup of a Tenant owner ServiceAccount, or of all the enabled ones",
+		Args:  cobra.NoArgs,
+		RunE:  opts.Run,
+	}
+
+	opts.AddFlags(cmd)
+
+	cmd.Flags().StringVarP(&opts.Namespace, "namespace", "n", "", "Namespace of the ServiceAccounts, all the Namespaces when not set")
+	cmd.Flags().StringVar(&opts.ServiceAccount, "serviceaccount", "", "Name of the ServiceAccount, all the enabled ones when not set")
+	cmd.Flags().StringVarP(&opts.Output, "output", "o", OutputText, fmt.Sprintf("Format of the report, one of %s or %s", OutputText, OutputJSON))
+
+	return cmd
+}
+
+func (o *Options) Run(cmd *cobra.Command, _ []string) error {
+	if o.Output != OutputText && o.Output != OutputJSON {
+		return errors.Errorf("invalid output %q, expected %s or %s", o.Output, OutputText, OutputJSON)
+	}
+
+	if o.ServiceAccount != "" && o.Namespace == "" {
+		return errors.New("the namespace of the ServiceAccount is required")
+	}
+
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	addon, err := o.Start(ctx)
+	if err != nil {
+		return err
+	}
+
+	serviceAccounts, err := o.serviceAccounts(ctx, addon.Client)
+	if err != nil {
+		return err
+	}
+
+	diagnoses := make([]*serviceaccount.Diagnosis, 0, len(serviceAccounts))
+	failed := 0
+
+	for i := range serviceAccounts {
+		sa := &serviceAccounts[i]
+
+		settings, settingsErr := addon.Credentials.ServiceAccountSettings(ctx, sa)
+		if settingsErr != nil {
+			return errors.Wrapf(settingsErr, "unable to resolve the settings of the ServiceAccount %s/%s", sa.Namespace, sa.Name)
+		}
+
+		diagnosis := addon.Issuer.Diagnose(ctx, sa, settings)
+		if diagnosis.Failed() {
+			failed++
+		}
+
+		diagnoses = append(diagnoses, diagnosis)
+	}
+
+	if err = write(cmd.OutOrStdout(), o.Output, diagnoses); err != nil {
+		return err
+	}
+
+	if failed > 0 {
+		return errors.Errorf("%d out of %d ServiceAccounts failed the checks", failed, len(diagnoses))
+	}
+
+	return nil
+}
+
+// serviceAccounts returns the ServiceAccount specified, or the enabled ones, either with the annotation or referred
+// by a FluxTenantCredential.
+func (o *Options) serviceAccounts(ctx context.Context, c client.Client) ([]corev1.ServiceAccount, error) {
+	if o.ServiceAccount != "" {
+		sa := new(corev1.ServiceAccount)
+		if err := c.Get(ctx, types.NamespacedName{Namespace: o.Namespace, Name: o.ServiceAccount}, sa); err != nil {
+			return nil, errors.Wrap(err, "unable to get the ServiceAccount")
+		}
+
+		return []corev1.ServiceAccount{*sa}, nil
+	}
+
+	ftcList := new(v1alpha1.FluxTenantCredentialList)
+	if err := c.List(ctx, ftcList, client.InNamespace(o.Namespace)); err != nil {
+		return nil, errors.Wrap(err, "unable to list the FluxTenantCredentials")
+	}
+
+	referred := make(map[types.NamespacedName]struct{}, len(ftcList.Items))
+	for _, ftc := range ftcList.Items {
+		referred[types.NamespacedName{Namespace: ftc.Namespace, Name: ftc.Spec.ServiceAccountName}] = struct{}{}
+	}
+
+	saList := new(corev1.ServiceAccountList)
+	if err := c.List(ctx, saList, client.InNamespace(o.Namespace)); err != nil {
+		return nil, errors.Wrap(err, "unable to list the ServiceAccounts")
+	}
+
+	serviceAccounts := make([]corev1.ServiceAccount, 0)
+
+	for _, sa := range saList.Items {
+		if _, ok := referred[types.NamespacedName{Namespace: sa.Namespace, Name: sa.Name}]; ok || serviceaccount.IsAddonEnabled(&sa) {
+			serviceAccounts = append(serviceAccounts, sa)
+		}
+	}
+
+	return serviceAccounts, nil
+}
+
+// write writes the report of the diagnoses in the output format specified.
+func write(w io.Writer, output string, diagnoses []*serviceaccount.Diagnosis) error {
+	if output == OutputJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(diagnoses)
+	}
+
+	for _, diagnosis := range diagnoses {
+		if _, err := fmt.Fprintf(w, "%s/%s\n", diagnosis.Namespace, diagnosis.ServiceAccount); err != nil {
+			return err
+		}
+
+		for _, check := range diagnosis.Checks {
+			if _, err := fmt.Fprintf(w, "  [%s] %s: %s\n", strings.ToUpper(string(check.Status)), check.Name, check.Message); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
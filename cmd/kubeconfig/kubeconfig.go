@@ -0,0 +1,92 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package kubeconfig
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/projectcapsule/capsule-addon-flux/pkg/cli"
+)
+
+type Options struct {
+	cli.Options
+
+	Namespace      string
+	ServiceAccount string
+	TokenTTL       time.Duration
+	Output         string
+}
+
+func New() *cobra.Command {
+	opts := new(Options)
+
+	cmd := &cobra.Command{
+		Use:   "kubeconfig",
+		Short: "Prints the kubeConfig of a Tenant owner ServiceAccount, pointing to Capsule Proxy",
+		Args:  cobra.NoArgs,
+		RunE:  opts.Run,
+	}
+
+	opts.AddFlags(cmd)
+
+	cmd.Flags().StringVarP(&opts.Namespace, "namespace", "n", "", "Namespace of the ServiceAccount")
+	cmd.Flags().StringVar(&opts.ServiceAccount, "serviceaccount", "", "Name of the ServiceAccount")
+	cmd.Flags().DurationVar(&opts.TokenTTL, "token-ttl", 0, "Lifetime of a fresh token requested with the TokenRequest API, in place of the issued one")
+	cmd.Flags().StringVarP(&opts.Output, "output", "o", "", "File the kubeConfig is written to, in place of the standard output")
+
+	_ = cmd.MarkFlagRequired("namespace")
+	_ = cmd.MarkFlagRequired("serviceaccount")
+
+	return cmd
+}
+
+func (o *Options) Run(cmd *cobra.Command, _ []string) error {
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	addon, err := o.Start(ctx)
+	if err != nil {
+		return err
+	}
+
+	sa := new(corev1.ServiceAccount)
+	if err = addon.Client.Get(ctx, types.NamespacedName{Namespace: o.Namespace, Name: o.ServiceAccount}, sa); err != nil {
+		return errors.Wrap(err, "unable to get the ServiceAccount")
+	}
+
+	settings, err := addon.Credentials.ServiceAccountSettings(ctx, sa)
+	if err != nil {
+		return errors.Wrap(err, "unable to resolve the settings of the ServiceAccount")
+	}
+
+	config, err := addon.Issuer.Kubeconfig(ctx, sa, settings, o.TokenTTL)
+	if err != nil {
+		return errors.Wrap(err, "unable to build the kubeConfig")
+	}
+
+	raw, err := clientcmd.Write(*config)
+	if err != nil {
+		return errors.Wrap(err, "unable to serialize the kubeConfig")
+	}
+
+	if o.Output == "" {
+		_, err = cmd.OutOrStdout().Write(raw)
+
+		return err
+	}
+
+	if err = os.WriteFile(o.Output, raw, 0o600); err != nil {
+		return errors.Wrap(err, "unable to write the kubeConfig")
+	}
+
+	return nil
+}
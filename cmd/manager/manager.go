@@ -11,10 +11,9 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"github.com/projectcapsule/capsule/pkg/indexer/tenant"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap/zapcore"
-	"k8s.io/apimachinery/pkg/runtime"
-	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -22,13 +21,28 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
+	"github.com/projectcapsule/capsule-addon-flux/pkg/cli"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/addonconfiguration"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/fluxtenantcredential"
 	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/serviceaccount"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/health"
 	"github.com/projectcapsule/capsule-addon-flux/pkg/indexer"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/metrics"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/version"
 )
 
 type Options struct {
-	ProxyURL    string
-	ProxyCAPath string
+	ProxyURL     string
+	ProxyCAPath  string
+	Distribution string
+
+	OwnerGroupPatterns []string
+	OwnerClusterRoles  []string
+	ConfigurationName  string
+	FluxControllers    []string
+	DryRun             bool
+	Paused             bool
+	VerifyProxy        bool
 
 	SetupLog logr.Logger
 	Zo       *zap.Options
@@ -57,6 +71,26 @@ func New() *cobra.Command {
 	// Add Proxy options.
 	cmd.Flags().StringVar(&opts.ProxyURL, "proxy-url", "https://capsule-proxy.capsule-system.svc:9001", "Kubernetes Service URL on which Capsule Proxy is waiting for connections")
 	cmd.Flags().StringVar(&opts.ProxyCAPath, "proxy-ca-path", "/tmp/ca.crt", "File containing the Certificate Authority used by Capsule Proxy")
+	cmd.Flags().BoolVar(&opts.VerifyProxy, "verify-proxy", false, "Verify the kubeConfigs authenticate the ServiceAccounts through Capsule Proxy, with a SelfSubjectReview, before publishing them")
+
+	// Add kubeConfig distribution options.
+	cmd.Flags().StringVar(&opts.Distribution, "kubeconfig-distribution", serviceaccount.DistributionGlobalTenantResource, fmt.Sprintf("Default Capsule resource used to distribute the kubeConfig across Tenant Namespaces, one of %s or %s", serviceaccount.DistributionGlobalTenantResource, serviceaccount.DistributionTenantResource))
+
+	// Add Tenant ownership options.
+	cmd.Flags().StringSliceVar(&opts.OwnerGroupPatterns, "owner-group-patterns", []string{serviceaccount.DefaultOwnerGroupPattern}, fmt.Sprintf("Patterns of the Groups a ServiceAccount is a member of, used to resolve the Tenants owned through Group owners: %s and %s are replaced with the ServiceAccount namespace and name", serviceaccount.OwnerGroupPatternNamespace, serviceaccount.OwnerGroupPatternName))
+	cmd.Flags().StringSliceVar(&opts.OwnerClusterRoles, "owner-cluster-roles", nil, "ClusterRoles granting the Tenant ownership to the ServiceAccounts bound to them with the Tenant additionalRoleBindings, none by default")
+
+	// Add impersonation mode options.
+	cmd.Flags().StringSliceVar(&opts.FluxControllers, "flux-controllers", serviceaccount.DefaultFluxControllers, "ServiceAccounts of the Flux controllers, in the namespace/name form, granted the impersonation of the ServiceAccounts in the Impersonation mode")
+
+	// Add AddonConfiguration options.
+	cmd.Flags().StringVar(&opts.ConfigurationName, "configuration-name", "default", "Name of the cluster-scoped AddonConfiguration defining the platform defaults, overriding the ones set with flags")
+
+	// Add dry-run options.
+	cmd.Flags().BoolVar(&opts.DryRun, "dry-run", false, "Compute the generated objects without writing them, logging the changes and reporting them with Events on the ServiceAccounts")
+
+	// Add pause options.
+	cmd.Flags().BoolVar(&opts.Paused, "paused", false, "Pause the reconciliation of all the ServiceAccounts, leaving the generated objects as they are")
 
 	// Add Zap options.
 	var fs flag.FlagSet
@@ -68,17 +102,17 @@ func New() *cobra.Command {
 }
 
 func (o *Options) Run(_ *cobra.Command, _ []string) error {
-	scheme := runtime.NewScheme()
-	if err := clientgoscheme.AddToScheme(scheme); err != nil {
-		return errors.Wrap(err, "unable to add client-go types to the manager's scheme")
-	}
-
-	if err := capsulev1beta2.AddToScheme(scheme); err != nil {
-		return errors.Wrap(err, "unable to add Capsule types to the manager's scheme")
+	scheme, err := cli.NewScheme()
+	if err != nil {
+		return errors.Wrap(err, "unable to build the manager's scheme")
 	}
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(o.Zo)))
 
+	info := version.Get()
+	o.SetupLog.Info("starting the Capsule addon for FluxCD", "version", info.Version, "commit", info.Commit, "date", info.Date)
+	metrics.BuildInfo.WithLabelValues(info.Version, info.Commit, info.Date, info.GoVersion, info.CapsuleVersion).Set(1)
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
@@ -97,7 +131,6 @@ func (o *Options) Run(_ *cobra.Command, _ []string) error {
 		return errors.Wrap(err, "unable to create manager")
 	}
 
-	_ = mgr.AddReadyzCheck("ping", healthz.Ping)
 	_ = mgr.AddHealthzCheck("ping", healthz.Ping)
 
 	proxyCA, err := os.ReadFile(o.ProxyCAPath)
@@ -107,23 +140,100 @@ func (o *Options) Run(_ *cobra.Command, _ []string) error {
 
 	ctx := ctrl.SetupSignalHandler()
 
-	if err = indexer.AddToManager(ctx, o.SetupLog, mgr); err != nil {
-		o.SetupLog.Error(err, "unable to setup indexers")
+	tenantResolvers := serviceaccount.DetectTenantResolvers(mgr.GetRESTMapper(), o.OwnerClusterRoles)
+	for _, resolver := range tenantResolvers {
+		o.SetupLog.Info("enabling Tenant resolver", "resolver", resolver.Name())
+	}
 
-		return errors.Wrap(err, "unable to setup indexers")
+	fluxControllers, err := serviceaccount.ParseFluxControllers(o.FluxControllers)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse the Flux controllers")
 	}
 
-	if err = serviceaccount.NewServiceAccountReconciler(
+	bootstrapSources := serviceaccount.DetectBootstrapSources(mgr.GetRESTMapper())
+	if len(bootstrapSources) == 0 {
+		o.SetupLog.Info("Flux source and Kustomization APIs not found, disabling the bootstrap")
+	}
+
+	for _, source := range bootstrapSources {
+		o.SetupLog.Info("enabling bootstrap source", "kind", source.Kind)
+	}
+
+	if o.DryRun {
+		o.SetupLog.Info("dry-run mode enabled, the changes are only logged and reported with Events")
+	}
+
+	if o.Paused {
+		o.SetupLog.Info("reconciliation paused, the generated objects are left as they are")
+	}
+
+	notifications := serviceaccount.DetectNotifications(mgr.GetRESTMapper())
+	if !notifications {
+		o.SetupLog.Info("Flux notification APIs not found, disabling the notifications")
+	}
+
+	saReconciler := serviceaccount.NewServiceAccountReconciler(
 		serviceaccount.WithClient(mgr.GetClient()),
 		serviceaccount.WithLogger(ctrl.Log.WithName("controller").WithName("ServiceAccount")),
 		serviceaccount.WithProxyCA(string(proxyCA)),
 		serviceaccount.WithProxyURL(o.ProxyURL),
-	).SetupWithManager(ctx, mgr); err != nil {
+		serviceaccount.WithDistribution(o.Distribution),
+		serviceaccount.WithOwnerGroupPatterns(o.OwnerGroupPatterns),
+		serviceaccount.WithTenantResolvers(tenantResolvers...),
+		serviceaccount.WithConfigurationName(o.ConfigurationName),
+		serviceaccount.WithBootstrapSources(bootstrapSources...),
+		serviceaccount.WithNotifications(notifications),
+		serviceaccount.WithFluxControllers(fluxControllers),
+		serviceaccount.WithEventRecorder(mgr.GetEventRecorderFor("capsule-addon-fluxcd")),
+		serviceaccount.WithDryRun(o.DryRun),
+		serviceaccount.WithPaused(o.Paused),
+		serviceaccount.WithProxyVerification(o.VerifyProxy),
+	)
+
+	if err = indexer.AddToManager(ctx, o.SetupLog, mgr, saReconciler.Indexers()...); err != nil {
+		o.SetupLog.Error(err, "unable to setup indexers")
+
+		return errors.Wrap(err, "unable to setup indexers")
+	}
+
+	// The readiness reflects the dependencies of the addon, reported one by one on /readyz?verbose.
+	for name, check := range map[string]healthz.Checker{
+		"cache-sync":         health.CacheSync(mgr.GetCache()),
+		"capsule-crds":       health.CRDs(mgr.GetRESTMapper(), capsulev1beta2.GroupVersion.WithKind("Tenant"), capsulev1beta2.GroupVersion.WithKind("GlobalTenantResource")),
+		"proxy-ca":           health.ProxyCA(proxyCA),
+		"tenant-owner-index": health.Index(mgr.GetCache(), tenant.OwnerReference{}, &capsulev1beta2.TenantList{}),
+	} {
+		if err = mgr.AddReadyzCheck(name, check); err != nil {
+			return errors.Wrapf(err, "unable to add the %s readiness check", name)
+		}
+	}
+
+	if err = saReconciler.SetupWithManager(ctx, mgr); err != nil {
 		o.SetupLog.Error(err, "unable to create manager", "controller", "ServiceAccount")
 
 		return errors.Wrap(err, "unable to setup the service account controller")
 	}
 
+	if err = addonconfiguration.NewAddonConfigurationReconciler(
+		addonconfiguration.WithClient(mgr.GetClient()),
+		addonconfiguration.WithLogger(ctrl.Log.WithName("controller").WithName("AddonConfiguration")),
+		addonconfiguration.WithConfigurationName(o.ConfigurationName),
+	).SetupWithManager(mgr); err != nil {
+		o.SetupLog.Error(err, "unable to create manager", "controller", "AddonConfiguration")
+
+		return errors.Wrap(err, "unable to setup the addon configuration controller")
+	}
+
+	if err = fluxtenantcredential.NewFluxTenantCredentialReconciler(
+		fluxtenantcredential.WithClient(mgr.GetClient()),
+		fluxtenantcredential.WithLogger(ctrl.Log.WithName("controller").WithName("FluxTenantCredential")),
+		fluxtenantcredential.WithIssuer(saReconciler),
+	).SetupWithManager(mgr); err != nil {
+		o.SetupLog.Error(err, "unable to create manager", "controller", "FluxTenantCredential")
+
+		return errors.Wrap(err, "unable to setup the flux tenant credential controller")
+	}
+
 	if err = mgr.Start(ctx); err != nil {
 		o.SetupLog.Error(err, "problem running manager")
 
@@ -0,0 +1,265 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package render
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"github.com/projectcapsule/capsule/pkg/indexer/tenant"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/cli"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/addonconfiguration"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/fluxtenantcredential"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/serviceaccount"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/indexer"
+)
+
+type Options struct {
+	Filenames          []string
+	ProxyURL           string
+	ProxyCAPath        string
+	Distribution       string
+	OwnerGroupPatterns []string
+	OwnerClusterRoles  []string
+	ConfigurationName  string
+	FluxControllers    []string
+}
+
+func New() *cobra.Command {
+	opts := new(Options)
+
+	cmd := &cobra.Command{
+		Use:   "render",
+		Short: "Prints the objects the Capsule addon for FluxCD would generate for the ServiceAccounts, without contacting a cluster",
+		Args:  cobra.NoArgs,
+		RunE:  opts.Run,
+	}
+
+	cmd.Flags().StringSliceVarP(&opts.Filenames, "filename", "f", nil, "Files containing the ServiceAccounts and the Tenants they own, along with their Namespaces, FluxTenantCredentials and AddonConfiguration, if any")
+	cmd.Flags().StringVar(&opts.ProxyURL, "proxy-url", "https://capsule-proxy.capsule-system.svc:9001", "Kubernetes Service URL on which Capsule Proxy is waiting for connections")
+	cmd.Flags().StringVar(&opts.ProxyCAPath, "proxy-ca-path", "", "File containing the Certificate Authority used by Capsule Proxy")
+	cmd.Flags().StringVar(&opts.Distribution, "kubeconfig-distribution", serviceaccount.DistributionGlobalTenantResource, fmt.Sprintf("Default Capsule resource used to distribute the kubeConfig across Tenant Namespaces, one of %s or %s", serviceaccount.DistributionGlobalTenantResource, serviceaccount.DistributionTenantResource))
+	cmd.Flags().StringSliceVar(&opts.OwnerGroupPatterns, "owner-group-patterns", []string{serviceaccount.DefaultOwnerGroupPattern}, fmt.Sprintf("Patterns of the Groups a ServiceAccount is a member of, used to resolve the Tenants owned through Group owners: %s and %s are replaced with the ServiceAccount namespace and name", serviceaccount.OwnerGroupPatternNamespace, serviceaccount.OwnerGroupPatternName))
+	cmd.Flags().StringSliceVar(&opts.OwnerClusterRoles, "owner-cluster-roles", nil, "ClusterRoles granting the Tenant ownership to the ServiceAccounts bound to them with the Tenant additionalRoleBindings, none by default")
+	cmd.Flags().StringVar(&opts.ConfigurationName, "configuration-name", "default", "Name of the cluster-scoped AddonConfiguration defining the platform defaults")
+	cmd.Flags().StringSliceVar(&opts.FluxControllers, "flux-controllers", serviceaccount.DefaultFluxControllers, "ServiceAccounts of the Flux controllers, in the namespace/name form, granted the impersonation of the ServiceAccounts in the Impersonation mode")
+
+	_ = cmd.MarkFlagRequired("filename")
+
+	return cmd
+}
+
+func (o *Options) Run(cmd *cobra.Command, _ []string) error {
+	ctx, cancel := context.WithCancel(cmd.Context())
+	defer cancel()
+
+	scheme, err := cli.NewScheme()
+	if err != nil {
+		return err
+	}
+
+	objs, err := o.read(scheme)
+	if err != nil {
+		return err
+	}
+
+	var proxyCA []byte
+	if o.ProxyCAPath != "" {
+		if proxyCA, err = os.ReadFile(o.ProxyCAPath); err != nil {
+			return errors.Wrap(err, "unable to read the CA file")
+		}
+	}
+
+	fluxControllers, err := serviceaccount.ParseFluxControllers(o.FluxControllers)
+	if err != nil {
+		return errors.Wrap(err, "unable to parse the Flux controllers")
+	}
+
+	objs, serviceAccounts := prepare(objs)
+
+	// The Flux APIs are assumed installed: the bootstrap and notification objects are rendered when configured.
+	issuerOpts := []serviceaccount.Option{
+		serviceaccount.WithLogger(logr.Discard()),
+		serviceaccount.WithProxyCA(string(proxyCA)),
+		serviceaccount.WithProxyURL(o.ProxyURL),
+		serviceaccount.WithDistribution(o.Distribution),
+		serviceaccount.WithOwnerGroupPatterns(o.OwnerGroupPatterns),
+		serviceaccount.WithTenantResolvers(serviceaccount.OwnersTenantResolver{}, serviceaccount.AdditionalRoleBindingsTenantResolver{ClusterRoles: o.OwnerClusterRoles}),
+		serviceaccount.WithConfigurationName(o.ConfigurationName),
+		serviceaccount.WithBootstrapSources(serviceaccount.BootstrapSourceGroupVersionKinds...),
+		serviceaccount.WithNotifications(true),
+		serviceaccount.WithFluxControllers(fluxControllers),
+	}
+
+	// The objects read from the files are served by an in-memory client, to resolve the Tenants and the settings, and
+	// to compute the objects, with the same lookups as the reconcilers.
+	builder := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...)
+	for _, idx := range append(serviceaccount.NewServiceAccountReconciler(issuerOpts...).Indexers(), tenant.OwnerReference{}, indexer.FluxTenantCredentialServiceAccount{}) {
+		builder = builder.WithIndex(idx.Object(), idx.Field(), idx.Func())
+	}
+
+	c := builder.Build()
+
+	issuer := serviceaccount.NewServiceAccountReconciler(append(issuerOpts, serviceaccount.WithClient(c))...)
+
+	credentials := fluxtenantcredential.NewFluxTenantCredentialReconciler(
+		fluxtenantcredential.WithClient(c),
+		fluxtenantcredential.WithLogger(logr.Discard()),
+		fluxtenantcredential.WithIssuer(issuer),
+	)
+
+	printer := json.NewSerializerWithOptions(json.DefaultMetaFactory, scheme, scheme, json.SerializerOptions{Yaml: true})
+
+	for _, sa := range serviceAccounts {
+		settings, settingsErr := credentials.ServiceAccountSettings(ctx, sa)
+		if settingsErr != nil {
+			return errors.Wrapf(settingsErr, "unable to resolve the settings of the ServiceAccount %s/%s", sa.Namespace, sa.Name)
+		}
+
+		rendered, renderErr := issuer.Render(ctx, sa, settings)
+		if renderErr != nil {
+			return errors.Wrapf(renderErr, "unable to render the ServiceAccount %s/%s", sa.Namespace, sa.Name)
+		}
+
+		if err = write(cmd.OutOrStdout(), printer, rendered); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// read returns the objects decoded from the files.
+func (o *Options) read(scheme *runtime.Scheme) ([]client.Object, error) {
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+
+	var objs []client.Object
+
+	for _, filename := range o.Filenames {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to open the file")
+		}
+
+		reader := yaml.NewYAMLReader(bufio.NewReader(f))
+
+		for {
+			doc, readErr := reader.Read()
+			if errors.Is(readErr, io.EOF) {
+				break
+			}
+
+			if readErr != nil {
+				_ = f.Close()
+
+				return nil, errors.Wrapf(readErr, "unable to read %s", filename)
+			}
+
+			obj, _, decodeErr := decoder.Decode(doc, nil, nil)
+			if runtime.IsMissingKind(decodeErr) {
+				continue
+			}
+
+			if decodeErr != nil {
+				_ = f.Close()
+
+				return nil, errors.Wrapf(decodeErr, "unable to decode %s", filename)
+			}
+
+			if clientObj, ok := obj.(client.Object); ok {
+				objs = append(objs, clientObj)
+			}
+		}
+
+		_ = f.Close()
+	}
+
+	return objs, nil
+}
+
+// prepare completes the objects read from the files as the cluster would, returning them along with the
+// ServiceAccounts: the AddonConfigurations are validated, and the missing Namespaces of the ServiceAccounts are added,
+// controlled by the Tenant listing them.
+func prepare(objs []client.Object) ([]client.Object, []*corev1.ServiceAccount) {
+	var (
+		serviceAccounts []*corev1.ServiceAccount
+		tenants         []capsulev1beta2.Tenant
+	)
+
+	namespaces := make(map[string]bool)
+
+	for _, obj := range objs {
+		switch o := obj.(type) {
+		case *corev1.ServiceAccount:
+			serviceAccounts = append(serviceAccounts, o)
+		case *capsulev1beta2.Tenant:
+			tenants = append(tenants, *o)
+		case *corev1.Namespace:
+			namespaces[o.Name] = true
+		case *v1alpha1.AddonConfiguration:
+			if len(addonconfiguration.Validate(o)) == 0 {
+				meta.SetStatusCondition(&o.Status.Conditions, metav1.Condition{
+					Type:               v1alpha1.ReadyCondition,
+					Status:             metav1.ConditionTrue,
+					Reason:             "Rendered",
+					ObservedGeneration: o.Generation,
+				})
+			}
+		}
+	}
+
+	for _, sa := range serviceAccounts {
+		if namespaces[sa.Namespace] {
+			continue
+		}
+
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: sa.Namespace}}
+
+		for _, tnt := range tenants {
+			for _, name := range tnt.Status.Namespaces {
+				if name == sa.Namespace {
+					ns.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(&tnt, capsulev1beta2.GroupVersion.WithKind("Tenant"))}
+				}
+			}
+		}
+
+		namespaces[sa.Namespace] = true
+		objs = append(objs, ns)
+	}
+
+	return objs, serviceAccounts
+}
+
+// write writes the objects as YAML documents.
+func write(w io.Writer, printer runtime.Encoder, objs []client.Object) error {
+	for _, obj := range objs {
+		if _, err := io.WriteString(w, "---\n"); err != nil {
+			return err
+		}
+
+		if err := printer.Encode(obj, w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -6,7 +6,13 @@ package cmd
 import (
 	"github.com/spf13/cobra"
 
+	"github.com/projectcapsule/capsule-addon-flux/cmd/audit"
+	"github.com/projectcapsule/capsule-addon-flux/cmd/cleanup"
+	"github.com/projectcapsule/capsule-addon-flux/cmd/doctor"
+	"github.com/projectcapsule/capsule-addon-flux/cmd/kubeconfig"
 	"github.com/projectcapsule/capsule-addon-flux/cmd/manager"
+	"github.com/projectcapsule/capsule-addon-flux/cmd/render"
+	"github.com/projectcapsule/capsule-addon-flux/cmd/version"
 )
 
 func New() *cobra.Command {
@@ -15,6 +21,12 @@ func New() *cobra.Command {
 	}
 
 	cmd.AddCommand(manager.New())
+	cmd.AddCommand(kubeconfig.New())
+	cmd.AddCommand(doctor.New())
+	cmd.AddCommand(audit.New())
+	cmd.AddCommand(cleanup.New())
+	cmd.AddCommand(render.New())
+	cmd.AddCommand(version.New())
 
 	return cmd
 }
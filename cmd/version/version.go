@@ -0,0 +1,57 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package version
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/projectcapsule/capsule-addon-flux/pkg/version"
+)
+
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+type Options struct {
+	Output string
+}
+
+func New() *cobra.Command {
+	opts := new(Options)
+
+	cmd := &cobra.Command{
+		Use:   "version",
+		Short: "Prints the build information of the Capsule addon for FluxCD",
+		Args:  cobra.NoArgs,
+		RunE:  opts.Run,
+	}
+
+	cmd.Flags().StringVarP(&opts.Output, "output", "o", OutputText, fmt.Sprintf("Format of the build information, one of %s or %s", OutputText, OutputJSON))
+
+	return cmd
+}
+
+func (o *Options) Run(cmd *cobra.Command, _ []string) error {
+	info := version.Get()
+
+	switch o.Output {
+	case OutputJSON:
+		encoder := json.NewEncoder(cmd.OutOrStdout())
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(info)
+	case OutputText:
+		_, err := fmt.Fprintf(cmd.OutOrStdout(), "Version:      %s\nGit commit:   %s\nBuild date:   %s\nGo version:   %s\nCapsule API:  %s\n",
+			info.Version, info.Commit, info.Date, info.GoVersion, info.CapsuleVersion)
+
+		return err
+	default:
+		return errors.Errorf("invalid output %q, expected %s or %s", o.Output, OutputText, OutputJSON)
+	}
+}
@@ -0,0 +1,157 @@
+//go:build e2e
+
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/serviceaccount"
+)
+
+const (
+	CredentialTenantName            = "gas"
+	CredentialTenantSystemNamespace = "gas-system"
+	CredentialName                  = "gitops-reconciler"
+)
+
+var _ = Describe("Managing a FluxTenantCredential", Ordered, func() {
+	var (
+		sa  *corev1.ServiceAccount
+		ftc *v1alpha1.FluxTenantCredential
+	)
+
+	defaultSecretName := types.NamespacedName{
+		Namespace: CredentialTenantSystemNamespace,
+		Name:      fmt.Sprintf("%s%s", TenantOwnerSAName, serviceaccount.SecretNameSuffixKubeconfig),
+	}
+	customSecretName := types.NamespacedName{
+		Namespace: CredentialTenantSystemNamespace,
+		Name:      "gas-kubeconfig",
+	}
+
+	BeforeAll(func() {
+		Expect(adminClient.Create(context.TODO(), &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: CredentialTenantSystemNamespace,
+			},
+		})).Should(Succeed())
+
+		Expect(adminClient.Create(context.TODO(), &capsulev1beta2.Tenant{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: CredentialTenantName,
+			},
+			Spec: capsulev1beta2.TenantSpec{
+				Owners: []capsulev1beta2.OwnerSpec{
+					{
+						Kind: "ServiceAccount",
+						Name: fmt.Sprintf("system:serviceaccount:%s:%s",
+							CredentialTenantSystemNamespace, TenantOwnerSAName),
+					},
+				},
+			},
+		})).Should(Succeed())
+
+		// The ServiceAccount is not annotated: the credential is issued by the FluxTenantCredential only.
+		sa = &corev1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      TenantOwnerSAName,
+				Namespace: CredentialTenantSystemNamespace,
+			},
+		}
+		Expect(adminClient.Create(context.TODO(), sa)).Should(Succeed())
+	})
+
+	AfterAll(func() {
+		Expect(client.IgnoreNotFound(adminClient.Delete(context.TODO(), sa))).Should(Succeed())
+
+		Expect(adminClient.Delete(context.TODO(), &capsulev1beta2.Tenant{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: CredentialTenantName,
+			},
+		})).Should(Succeed())
+
+		Eventually(func() error {
+			return adminClient.Delete(context.TODO(), &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: CredentialTenantSystemNamespace,
+				},
+			})
+		}).Should(Succeed())
+	})
+
+	It("should issue the kubeConfig Secret once created", func() {
+		ftc = &v1alpha1.FluxTenantCredential{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      CredentialName,
+				Namespace: CredentialTenantSystemNamespace,
+			},
+			Spec: v1alpha1.FluxTenantCredentialSpec{
+				ServiceAccountName: TenantOwnerSAName,
+			},
+		}
+		Expect(adminClient.Create(context.TODO(), ftc)).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			g.Expect(adminClient.Get(context.TODO(), client.ObjectKeyFromObject(ftc), ftc)).Should(Succeed())
+			g.Expect(meta.IsStatusConditionTrue(ftc.Status.Conditions, v1alpha1.ReadyCondition)).To(BeTrue())
+			g.Expect(ftc.Status.SecretName).To(Equal(defaultSecretName.Name))
+			g.Expect(ftc.Status.Tenants).To(ConsistOf(CredentialTenantName))
+
+			secret := new(corev1.Secret)
+			g.Expect(adminClient.Get(context.TODO(), defaultSecretName, secret)).Should(Succeed())
+			g.Expect(secret.Data[serviceaccount.SecretKeyKubeconfig]).ToNot(BeEmpty())
+		}, 20*time.Second, 1*time.Second).Should(Succeed())
+	})
+
+	It("should issue the kubeConfig Secret again once updated", func() {
+		Eventually(func() error {
+			if err := adminClient.Get(context.TODO(), client.ObjectKeyFromObject(ftc), ftc); err != nil {
+				return err
+			}
+			ftc.Spec.Secret = &v1alpha1.SecretSpec{Name: customSecretName.Name, Key: "config"}
+
+			return adminClient.Update(context.TODO(), ftc)
+		}, 20*time.Second, 1*time.Second).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			g.Expect(adminClient.Get(context.TODO(), client.ObjectKeyFromObject(ftc), ftc)).Should(Succeed())
+			g.Expect(ftc.Status.ObservedGeneration).To(Equal(ftc.Generation))
+			g.Expect(meta.IsStatusConditionTrue(ftc.Status.Conditions, v1alpha1.ReadyCondition)).To(BeTrue())
+			g.Expect(ftc.Status.SecretName).To(Equal(customSecretName.Name))
+
+			secret := new(corev1.Secret)
+			g.Expect(adminClient.Get(context.TODO(), customSecretName, secret)).Should(Succeed())
+			g.Expect(secret.Data["config"]).ToNot(BeEmpty())
+
+			By("deleting the previous kubeConfig Secret", func() {
+				err := adminClient.Get(context.TODO(), defaultSecretName, new(corev1.Secret))
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			})
+		}, 20*time.Second, 1*time.Second).Should(Succeed())
+	})
+
+	It("should delete the kubeConfig Secret once deleted", func() {
+		Expect(adminClient.Delete(context.TODO(), ftc)).Should(Succeed())
+
+		Eventually(func(g Gomega) {
+			err := adminClient.Get(context.TODO(), customSecretName, new(corev1.Secret))
+			g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		}, 20*time.Second, 1*time.Second).Should(Succeed())
+	})
+})
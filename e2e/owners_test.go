@@ -0,0 +1,126 @@
+//go:build e2e
+
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/serviceaccount"
+)
+
+const (
+	OwnersTenantName            = "water"
+	OwnersTenantSystemNamespace = "water-system"
+)
+
+// newGlobalServiceAccount returns the ServiceAccount of the namespace specified, with the annotations to enable the
+// addon and to make the kubeconfig global, so that a GlobalTenantResource is generated for each Tenant resolved.
+func newGlobalServiceAccount(namespace string) *corev1.ServiceAccount {
+	return &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      TenantOwnerSAName,
+			Namespace: namespace,
+			Annotations: map[string]string{
+				serviceaccount.ServiceAccountAddonAnnotationKey:  serviceaccount.ServiceAccountAddonAnnotationValue,
+				serviceaccount.ServiceAccountGlobalAnnotationKey: serviceaccount.ServiceAccountGlobalAnnotationValue,
+			},
+		},
+	}
+}
+
+// expectTenantResolved expects the GlobalTenantResource of the Tenant to be generated for the ServiceAccount, thus
+// the Tenant to be resolved as owned by it.
+func expectTenantResolved(tenantName string, sa *corev1.ServiceAccount) {
+	Eventually(func() error {
+		return adminClient.Get(context.TODO(), types.NamespacedName{
+			Name: fmt.Sprintf("%s-%s%s", tenantName, sa.Name, serviceaccount.GlobalTenantResourceSuffix),
+		}, new(capsulev1beta2.GlobalTenantResource))
+	}, 20*time.Second, 1*time.Second).Should(Succeed())
+}
+
+// expectTenantNotResolved expects the GlobalTenantResource of the Tenant generated for the ServiceAccount to be
+// deleted, along with the Tenant itself, not to leak into the following specs.
+func expectTenantNotResolved(tenantName string, sa *corev1.ServiceAccount) {
+	Eventually(func() bool {
+		return apierrors.IsNotFound(adminClient.Get(context.TODO(), types.NamespacedName{
+			Name: fmt.Sprintf("%s-%s%s", tenantName, sa.Name, serviceaccount.GlobalTenantResourceSuffix),
+		}, new(capsulev1beta2.GlobalTenantResource)))
+	}, 20*time.Second, 1*time.Second).Should(BeTrue())
+
+	Eventually(func() bool {
+		return apierrors.IsNotFound(adminClient.Get(context.TODO(), types.NamespacedName{Name: tenantName}, new(capsulev1beta2.Tenant)))
+	}, 20*time.Second, 1*time.Second).Should(BeTrue())
+}
+
+var _ = Describe("Resolving the Tenants owned by a ServiceAccount", Ordered, func() {
+	var sa *corev1.ServiceAccount
+
+	BeforeAll(func() {
+		Expect(adminClient.Create(context.TODO(), &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: OwnersTenantSystemNamespace,
+			},
+		})).Should(Succeed())
+	})
+
+	AfterAll(func() {
+		Eventually(func() error {
+			return adminClient.Delete(context.TODO(), &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: OwnersTenantSystemNamespace,
+				},
+			})
+		}).Should(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(adminClient.Delete(context.TODO(), sa)).Should(Succeed())
+
+		Expect(adminClient.Delete(context.TODO(), &capsulev1beta2.Tenant{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: OwnersTenantName,
+			},
+		})).Should(Succeed())
+
+		expectTenantNotResolved(OwnersTenantName, sa)
+	})
+
+	DescribeTable("should generate the kubeConfig distribution for the Tenant",
+		func(owner capsulev1beta2.OwnerSpec) {
+			Expect(adminClient.Create(context.TODO(), &capsulev1beta2.Tenant{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: OwnersTenantName,
+				},
+				Spec: capsulev1beta2.TenantSpec{
+					Owners: []capsulev1beta2.OwnerSpec{owner},
+				},
+			})).Should(Succeed())
+
+			sa = newGlobalServiceAccount(OwnersTenantSystemNamespace)
+			Expect(adminClient.Create(context.TODO(), sa)).Should(Succeed())
+
+			expectTenantResolved(OwnersTenantName, sa)
+		},
+		Entry("owned as User", capsulev1beta2.OwnerSpec{
+			Kind: capsulev1beta2.UserOwner,
+			Name: fmt.Sprintf("system:serviceaccount:%s:%s", OwnersTenantSystemNamespace, TenantOwnerSAName),
+		}),
+		Entry("owned through the Group of the ServiceAccounts of its Namespace", capsulev1beta2.OwnerSpec{
+			Kind: capsulev1beta2.GroupOwner,
+			Name: fmt.Sprintf("system:serviceaccounts:%s", OwnersTenantSystemNamespace),
+		}),
+	)
+})
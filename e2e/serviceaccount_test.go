@@ -14,10 +14,11 @@ import (
 	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
 	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/json"
 	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"time"
 
 	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/serviceaccount"
@@ -305,10 +306,28 @@ var _ = Describe("Creating a new ServiceAccount", func() {
 							TenantName,
 						))
 
+						By("referencing the kubeConfig Secret instead of embedding it", func() {
+							g.Expect(gtr.Spec.Resources[0].RawItems).To(BeEmpty())
+							g.Expect(len(gtr.Spec.Resources[0].NamespacedItems)).To(Equal(1))
+							item := gtr.Spec.Resources[0].NamespacedItems[0]
+							g.Expect(item.Kind).To(Equal("Secret"))
+							g.Expect(item.Namespace).To(Equal(TenantSystemNamespace))
+
+							secretList := new(corev1.SecretList)
+							g.Expect(adminClient.List(context.TODO(), secretList,
+								client.InNamespace(item.Namespace), client.MatchingLabels(item.Selector.MatchLabels))).To(Succeed())
+							g.Expect(len(secretList.Items)).To(Equal(1))
+							g.Expect(secretList.Items[0].Name).To(Equal(fmt.Sprintf("%s%s",
+								TenantOwnerSAName, serviceaccount.SecretNameSuffixKubeconfig)))
+						})
+
 						By("setting the server to Capsule Proxy", func() {
-							kcSecret := &corev1.Secret{}
-							g.Expect(len(gtr.Spec.Resources[0].RawItems)).To(Equal(1))
-							g.Expect(json.Unmarshal(gtr.Spec.Resources[0].RawItems[0].Raw, kcSecret)).To(Succeed())
+							kcSecret := new(corev1.Secret)
+							g.Expect(adminClient.Get(context.TODO(), types.NamespacedName{
+								Namespace: TenantSystemNamespace,
+								Name: fmt.Sprintf("%s%s",
+									TenantOwnerSAName, serviceaccount.SecretNameSuffixKubeconfig),
+							}, kcSecret)).To(Succeed())
 							g.Expect(kcSecret.Data[serviceaccount.SecretKeyKubeconfig]).ToNot(BeEmpty())
 
 							kc, err := clientcmd.Load(kcSecret.Data[serviceaccount.SecretKeyKubeconfig])
@@ -321,6 +340,127 @@ var _ = Describe("Creating a new ServiceAccount", func() {
 						})
 					}, 20*time.Second, 1*time.Second).Should(Succeed())
 				})
+
+				It("should delete the GlobalTenantResource when the kubeconfig is not global anymore", func() {
+					name := types.NamespacedName{
+						Name: fmt.Sprintf("%s-%s%s",
+							TenantName, TenantOwnerSAName, serviceaccount.GlobalTenantResourceSuffix),
+					}
+
+					Eventually(func() error {
+						return adminClient.Get(context.TODO(), name, new(capsulev1beta2.GlobalTenantResource))
+					}, 20*time.Second, 1*time.Second).Should(Succeed())
+
+					Eventually(func() error {
+						if err := adminClient.Get(context.TODO(), client.ObjectKeyFromObject(sa), sa); err != nil {
+							return err
+						}
+						delete(sa.Annotations, serviceaccount.ServiceAccountGlobalAnnotationKey)
+
+						return adminClient.Update(context.TODO(), sa)
+					}, 20*time.Second, 1*time.Second).Should(Succeed())
+
+					Eventually(func(g Gomega) {
+						err = adminClient.Get(context.TODO(), name, new(capsulev1beta2.GlobalTenantResource))
+						g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+					}, 20*time.Second, 1*time.Second).Should(Succeed())
+				})
+			})
+
+			When("has the annotations to enable the addon and to pause the reconciliation", func() {
+				BeforeEach(func() {
+					sa = &corev1.ServiceAccount{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      TenantOwnerSAName,
+							Namespace: TenantSystemNamespace,
+							Annotations: map[string]string{
+								serviceaccount.ServiceAccountAddonAnnotationKey: serviceaccount.ServiceAccountAddonAnnotationValue,
+								serviceaccount.PausedAnnotationKey:              serviceaccount.PausedAnnotationValue,
+							},
+						},
+					}
+					err = adminClient.Create(context.TODO(), sa)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+
+				AfterEach(func() {
+					Expect(adminClient.Delete(context.TODO(), sa)).Should(Succeed())
+				})
+
+				It("should generate the kubeConfig Secret only once resumed", func() {
+					name := types.NamespacedName{
+						Namespace: TenantSystemNamespace,
+						Name: fmt.Sprintf("%s%s",
+							TenantOwnerSAName, serviceaccount.SecretNameSuffixKubeconfig),
+					}
+
+					// The Secret generated for the ServiceAccount of the previous specs is garbage collected first.
+					Eventually(func() bool {
+						return apierrors.IsNotFound(adminClient.Get(context.TODO(), name, new(corev1.Secret)))
+					}, 20*time.Second, 1*time.Second).Should(BeTrue())
+
+					Consistently(func() bool {
+						return apierrors.IsNotFound(adminClient.Get(context.TODO(), name, new(corev1.Secret)))
+					}, 10*time.Second, 1*time.Second).Should(BeTrue())
+
+					Eventually(func() error {
+						if err := adminClient.Get(context.TODO(), client.ObjectKeyFromObject(sa), sa); err != nil {
+							return err
+						}
+						delete(sa.Annotations, serviceaccount.PausedAnnotationKey)
+
+						return adminClient.Update(context.TODO(), sa)
+					}, 20*time.Second, 1*time.Second).Should(Succeed())
+
+					Eventually(func() error {
+						return adminClient.Get(context.TODO(), name, new(corev1.Secret))
+					}, 20*time.Second, 1*time.Second).Should(Succeed())
+				})
+			})
+
+			When("has the annotations to make the kubeconfig global with a TenantResource", func() {
+				BeforeEach(func() {
+					sa = &corev1.ServiceAccount{
+						ObjectMeta: metav1.ObjectMeta{
+							Name:      TenantOwnerSAName,
+							Namespace: TenantSystemNamespace,
+							Annotations: map[string]string{
+								serviceaccount.ServiceAccountAddonAnnotationKey:        serviceaccount.ServiceAccountAddonAnnotationValue,
+								serviceaccount.ServiceAccountGlobalAnnotationKey:       serviceaccount.ServiceAccountGlobalAnnotationValue,
+								serviceaccount.ServiceAccountDistributionAnnotationKey: serviceaccount.DistributionTenantResource,
+							},
+						},
+					}
+					err = adminClient.Create(context.TODO(), sa)
+					Expect(err).ShouldNot(HaveOccurred())
+				})
+
+				AfterEach(func() {
+					Expect(adminClient.Delete(context.TODO(), sa)).Should(Succeed())
+				})
+
+				It("should generate TenantResource with the kubeConfig Secret", func() {
+					Eventually(func(g Gomega) {
+						tr := new(capsulev1beta2.TenantResource)
+						err = adminClient.Get(context.TODO(), types.NamespacedName{
+							Namespace: TenantSystemNamespace,
+							Name:      fmt.Sprintf("%s%s", TenantOwnerSAName, serviceaccount.TenantResourceSuffix),
+						}, tr)
+						g.Expect(err).Should(Succeed())
+						g.Expect(len(tr.Spec.Resources)).To(Equal(1))
+					}, 20*time.Second, 1*time.Second).Should(Succeed())
+				})
+
+				It("should not generate GlobalTenantResource for the Namespace Tenant", func() {
+					Eventually(func(g Gomega) {
+						gtr := new(capsulev1beta2.GlobalTenantResource)
+						err = adminClient.Get(context.TODO(), types.NamespacedName{
+							Name: fmt.Sprintf("%s-%s%s",
+								TenantName, TenantOwnerSAName, serviceaccount.GlobalTenantResourceSuffix),
+						}, gtr)
+						g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+					}, 20*time.Second, 1*time.Second).Should(Succeed())
+				})
 			})
 		})
 	})
@@ -24,10 +24,13 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
+	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
 	cmd "github.com/projectcapsule/capsule-addon-flux/cmd/manager"
 	"github.com/projectcapsule/capsule-addon-flux/e2e/utils"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/serviceaccount"
 )
 
 const (
@@ -57,6 +60,8 @@ const (
 	TenantOwnerSAName     = "gitops-reconciler"
 
 	CapsuleProxyCAFilePath = "/tmp/capsule-proxy-ca.crt"
+
+	AddonCRDsPath = "../charts/capsule-addon-fluxcd/crds"
 )
 
 var (
@@ -122,6 +127,7 @@ var _ = BeforeSuite(func() {
 
 		Expect(scheme.AddToScheme(scheme.Scheme)).NotTo(HaveOccurred())
 		Expect(capsulev1beta2.AddToScheme(scheme.Scheme)).NotTo(HaveOccurred())
+		Expect(v1alpha1.AddToScheme(scheme.Scheme)).NotTo(HaveOccurred())
 
 		c, err := client.New(adminConfig, client.Options{Scheme: scheme.Scheme})
 		Expect(err).ToNot(HaveOccurred())
@@ -145,11 +151,25 @@ var _ = BeforeSuite(func() {
 		Expect(err).ToNot(HaveOccurred())
 	})
 
+	By("Installing the addon CRDs", func() {
+		_, err = envtest.InstallCRDs(adminConfig, envtest.CRDInstallOptions{
+			Paths:              []string{AddonCRDsPath},
+			ErrorIfPathMissing: true,
+		})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
 	By("Starting the manager", func() {
 		mo := &cmd.Options{
 			ProxyURL:    fmt.Sprintf("https://capsule-proxy.%s.svc:9001", NamespaceCapsuleProxy),
 			ProxyCAPath: CapsuleProxyCAFilePath,
-			SetupLog:    ctrl.Log.WithName("setup"),
+			// The defaults of the flags, not parsed when running the manager from the suite.
+			OwnerGroupPatterns: []string{serviceaccount.DefaultOwnerGroupPattern},
+			ConfigurationName:  "default",
+			FluxControllers:    serviceaccount.DefaultFluxControllers,
+			// The Tenants resolved through the additional RoleBindings granting the admin ClusterRole.
+			OwnerClusterRoles: []string{"admin"},
+			SetupLog:          ctrl.Log.WithName("setup"),
 			Zo: &zap.Options{
 				EncoderConfigOptions: append([]zap.EncoderConfigOption{}, func(config *zapcore.EncoderConfig) {
 					config.EncodeTime = zapcore.ISO8601TimeEncoder
@@ -0,0 +1,198 @@
+//go:build e2e
+
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"github.com/projectcapsule/capsule/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/serviceaccount"
+)
+
+const (
+	ResolversTenantName            = "wind"
+	ResolversTenantSystemNamespace = "wind-system"
+)
+
+var _ = Describe("Resolving the Tenants with the newer Capsule ownership model", Ordered, func() {
+	var sa *corev1.ServiceAccount
+
+	BeforeAll(func() {
+		Expect(adminClient.Create(context.TODO(), &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: ResolversTenantSystemNamespace,
+			},
+		})).Should(Succeed())
+	})
+
+	AfterAll(func() {
+		Eventually(func() error {
+			return adminClient.Delete(context.TODO(), &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: ResolversTenantSystemNamespace,
+				},
+			})
+		}).Should(Succeed())
+	})
+
+	Context("granting a ClusterRole to the ServiceAccount with the additional RoleBindings", func() {
+		BeforeEach(func() {
+			Expect(adminClient.Create(context.TODO(), &capsulev1beta2.Tenant{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: ResolversTenantName,
+				},
+				Spec: capsulev1beta2.TenantSpec{
+					Owners: []capsulev1beta2.OwnerSpec{
+						{
+							Kind: capsulev1beta2.UserOwner,
+							Name: "alice",
+						},
+					},
+					AdditionalRoleBindings: []api.AdditionalRoleBindingsSpec{
+						{
+							ClusterRoleName: "admin",
+							Subjects: []rbacv1.Subject{
+								{
+									Kind:      rbacv1.ServiceAccountKind,
+									Name:      TenantOwnerSAName,
+									Namespace: ResolversTenantSystemNamespace,
+								},
+							},
+						},
+					},
+				},
+			})).Should(Succeed())
+
+			sa = newGlobalServiceAccount(ResolversTenantSystemNamespace)
+			Expect(adminClient.Create(context.TODO(), sa)).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(adminClient.Delete(context.TODO(), sa)).Should(Succeed())
+
+			Expect(adminClient.Delete(context.TODO(), &capsulev1beta2.Tenant{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: ResolversTenantName,
+				},
+			})).Should(Succeed())
+
+			expectTenantNotResolved(ResolversTenantName, sa)
+		})
+
+		It("should generate the kubeConfig distribution for the Tenant", func() {
+			expectTenantResolved(ResolversTenantName, sa)
+		})
+	})
+
+	Context("granting a ClusterRole not allowed to the ServiceAccount with the additional RoleBindings", func() {
+		BeforeEach(func() {
+			Expect(adminClient.Create(context.TODO(), &capsulev1beta2.Tenant{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: ResolversTenantName,
+				},
+				Spec: capsulev1beta2.TenantSpec{
+					Owners: []capsulev1beta2.OwnerSpec{
+						{
+							Kind: capsulev1beta2.UserOwner,
+							Name: "alice",
+						},
+					},
+					AdditionalRoleBindings: []api.AdditionalRoleBindingsSpec{
+						{
+							ClusterRoleName: "view",
+							Subjects: []rbacv1.Subject{
+								{
+									Kind:      rbacv1.ServiceAccountKind,
+									Name:      TenantOwnerSAName,
+									Namespace: ResolversTenantSystemNamespace,
+								},
+							},
+						},
+					},
+				},
+			})).Should(Succeed())
+
+			sa = newGlobalServiceAccount(ResolversTenantSystemNamespace)
+			Expect(adminClient.Create(context.TODO(), sa)).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(adminClient.Delete(context.TODO(), sa)).Should(Succeed())
+
+			Expect(adminClient.Delete(context.TODO(), &capsulev1beta2.Tenant{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: ResolversTenantName,
+				},
+			})).Should(Succeed())
+
+			expectTenantNotResolved(ResolversTenantName, sa)
+		})
+
+		It("should not generate the kubeConfig distribution for the Tenant", func() {
+			Consistently(func() bool {
+				return apierrors.IsNotFound(adminClient.Get(context.TODO(), types.NamespacedName{
+					Name: fmt.Sprintf("%s-%s%s", ResolversTenantName, sa.Name, serviceaccount.GlobalTenantResourceSuffix),
+				}, new(capsulev1beta2.GlobalTenantResource)))
+			}, 10*time.Second, 1*time.Second).Should(BeTrue())
+		})
+	})
+
+	Context("declared by a TenantOwner selected by the Tenant", func() {
+		var owner, tnt *unstructured.Unstructured
+
+		BeforeEach(func() {
+			// The TenantOwner resolver is enabled only by the Capsule versions serving the TenantOwner API.
+			if _, err := adminClient.RESTMapper().RESTMapping(serviceaccount.TenantOwnerGroupVersionKind.GroupKind(), serviceaccount.TenantOwnerGroupVersionKind.Version); err != nil {
+				Skip(fmt.Sprintf("the TenantOwner API is not served by the installed Capsule: %s", err))
+			}
+
+			owner = new(unstructured.Unstructured)
+			owner.SetGroupVersionKind(serviceaccount.TenantOwnerGroupVersionKind)
+			owner.SetName(TenantOwnerSAName)
+			owner.SetLabels(map[string]string{"team": ResolversTenantName})
+			Expect(unstructured.SetNestedField(owner.Object, capsulev1beta2.ServiceAccountOwner.String(), "spec", "kind")).Should(Succeed())
+			Expect(unstructured.SetNestedField(owner.Object, fmt.Sprintf("system:serviceaccount:%s:%s",
+				ResolversTenantSystemNamespace, TenantOwnerSAName), "spec", "name")).Should(Succeed())
+			Expect(adminClient.Create(context.TODO(), owner)).Should(Succeed())
+
+			// The compiled Tenant API lacks spec.permissions: the Tenant is created as unstructured.
+			tnt = new(unstructured.Unstructured)
+			tnt.SetGroupVersionKind(capsulev1beta2.GroupVersion.WithKind("Tenant"))
+			tnt.SetName(ResolversTenantName)
+			Expect(unstructured.SetNestedSlice(tnt.Object, []interface{}{
+				map[string]interface{}{"matchLabels": map[string]interface{}{"team": ResolversTenantName}},
+			}, "spec", "permissions", "matchOwners")).Should(Succeed())
+			Expect(adminClient.Create(context.TODO(), tnt)).Should(Succeed())
+
+			sa = newGlobalServiceAccount(ResolversTenantSystemNamespace)
+			Expect(adminClient.Create(context.TODO(), sa)).Should(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(adminClient.Delete(context.TODO(), sa)).Should(Succeed())
+			Expect(adminClient.Delete(context.TODO(), tnt)).Should(Succeed())
+			Expect(adminClient.Delete(context.TODO(), owner)).Should(Succeed())
+
+			expectTenantNotResolved(ResolversTenantName, sa)
+		})
+
+		It("should generate the kubeConfig distribution for the Tenant", func() {
+			expectTenantResolved(ResolversTenantName, sa)
+		})
+	})
+})
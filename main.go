@@ -8,9 +8,29 @@ import (
 	"os"
 
 	"github.com/projectcapsule/capsule-addon-flux/cmd"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/version"
+)
+
+// buildVersion, buildCommit and buildDate are set at build time with the linker flags.
+var (
+	buildVersion string
+	buildCommit  string
+	buildDate    string
 )
 
 func main() {
+	if buildVersion != "" {
+		version.Version = buildVersion
+	}
+
+	if buildCommit != "" {
+		version.Commit = buildCommit
+	}
+
+	if buildDate != "" {
+		version.Date = buildDate
+	}
+
 	if err := cmd.Execute(); err != nil {
 		//nolint:forbidigo
 		fmt.Println(err)
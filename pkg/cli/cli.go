@@ -0,0 +1,186 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"github.com/projectcapsule/capsule/pkg/indexer/tenant"
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/fluxtenantcredential"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/serviceaccount"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/indexer"
+)
+
+// Options are the options shared by the commands inspecting the cluster with the same settings as the manager.
+type Options struct {
+	ProxyURL      string
+	ProxyCAPath   string
+	ProxyCASecret string
+	ProxyCAKey    string
+
+	OwnerGroupPatterns []string
+	OwnerClusterRoles  []string
+	ConfigurationName  string
+	FluxControllers    []string
+
+	// WithoutProxy is set by the commands not building kubeConfigs, which do not need the Capsule Proxy settings.
+	WithoutProxy bool
+}
+
+// AddFlags adds the flags of the Options to the command specified.
+func (o *Options) AddFlags(cmd *cobra.Command) {
+	if !o.WithoutProxy {
+		o.addProxyFlags(cmd)
+	}
+
+	cmd.Flags().StringSliceVar(&o.OwnerGroupPatterns, "owner-group-patterns", []string{serviceaccount.DefaultOwnerGroupPattern}, fmt.Sprintf("Patterns of the Groups a ServiceAccount is a member of, used to resolve the Tenants owned through Group owners: %s and %s are replaced with the ServiceAccount namespace and name", serviceaccount.OwnerGroupPatternNamespace, serviceaccount.OwnerGroupPatternName))
+	cmd.Flags().StringSliceVar(&o.OwnerClusterRoles, "owner-cluster-roles", nil, "ClusterRoles granting the Tenant ownership to the ServiceAccounts bound to them with the Tenant additionalRoleBindings, none by default")
+	cmd.Flags().StringVar(&o.ConfigurationName, "configuration-name", "default", "Name of the cluster-scoped AddonConfiguration defining the platform defaults")
+	cmd.Flags().StringSliceVar(&o.FluxControllers, "flux-controllers", serviceaccount.DefaultFluxControllers, "ServiceAccounts of the Flux controllers, in the namespace/name form, granted the impersonation of the ServiceAccounts in the Impersonation mode")
+}
+
+// addProxyFlags adds the flags of the Capsule Proxy settings.
+func (o *Options) addProxyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.ProxyURL, "proxy-url", "https://capsule-proxy.capsule-system.svc:9001", "Kubernetes Service URL on which Capsule Proxy is waiting for connections")
+	cmd.Flags().StringVar(&o.ProxyCAPath, "proxy-ca-path", "", "File containing the Certificate Authority used by Capsule Proxy, read from the Capsule Proxy Secret when not set")
+	cmd.Flags().StringVar(&o.ProxyCASecret, "proxy-ca-secret", "capsule-system/capsule-proxy", "Secret, in the namespace/name form, containing the Certificate Authority used by Capsule Proxy")
+	cmd.Flags().StringVar(&o.ProxyCAKey, "proxy-ca-key", "ca", "Key of the Capsule Proxy Secret containing the Certificate Authority")
+}
+
+// Addon gives access to the cluster through an uncached client, along with the reconcilers resolving the
+// credentials the same way the manager does, without writing any object.
+type Addon struct {
+	Client      client.Client
+	Issuer      *serviceaccount.ServiceAccountReconciler
+	Credentials *fluxtenantcredential.FluxTenantCredentialReconciler
+}
+
+// NewScheme returns the scheme of the types handled by the addon.
+func NewScheme() (*runtime.Scheme, error) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		return nil, errors.Wrap(err, "unable to add client-go types to the scheme")
+	}
+
+	if err := capsulev1beta2.AddToScheme(scheme); err != nil {
+		return nil, errors.Wrap(err, "unable to add Capsule types to the scheme")
+	}
+
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		return nil, errors.Wrap(err, "unable to add addon types to the scheme")
+	}
+
+	return scheme, nil
+}
+
+// Start connects to the cluster of the current kubeConfig with an uncached client, returning the Addon: the objects
+// are read on demand from the API server, rather than watching all the kinds the addon handles.
+func (o *Options) Start(ctx context.Context) (*Addon, error) {
+	ctrl.SetLogger(logr.Discard())
+
+	fluxControllers, err := serviceaccount.ParseFluxControllers(o.FluxControllers)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse the Flux controllers")
+	}
+
+	config, err := ctrl.GetConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load the kubeConfig")
+	}
+
+	scheme, err := NewScheme()
+	if err != nil {
+		return nil, err
+	}
+
+	uncached, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to connect to the cluster")
+	}
+
+	// The indexed fields are served by the client itself, as the API server does not know them.
+	c := newIndexedClient(uncached)
+
+	var proxyCA []byte
+
+	if !o.WithoutProxy {
+		if proxyCA, err = o.proxyCA(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+
+	issuer := serviceaccount.NewServiceAccountReconciler(
+		serviceaccount.WithClient(c),
+		serviceaccount.WithLogger(logr.Discard()),
+		serviceaccount.WithProxyCA(string(proxyCA)),
+		serviceaccount.WithProxyURL(o.ProxyURL),
+		serviceaccount.WithOwnerGroupPatterns(o.OwnerGroupPatterns),
+		serviceaccount.WithTenantResolvers(serviceaccount.DetectTenantResolvers(c.RESTMapper(), o.OwnerClusterRoles)...),
+		serviceaccount.WithConfigurationName(o.ConfigurationName),
+		serviceaccount.WithBootstrapSources(serviceaccount.DetectBootstrapSources(c.RESTMapper())...),
+		serviceaccount.WithNotifications(serviceaccount.DetectNotifications(c.RESTMapper())),
+		serviceaccount.WithFluxControllers(fluxControllers),
+	)
+
+	if err = c.register(append([]indexer.CustomIndexer{
+		tenant.OwnerReference{},
+		indexer.FluxTenantCredentialServiceAccount{},
+	}, issuer.Indexers()...)...); err != nil {
+		return nil, errors.Wrap(err, "unable to setup indexers")
+	}
+
+	return &Addon{
+		Client: c,
+		Issuer: issuer,
+		Credentials: fluxtenantcredential.NewFluxTenantCredentialReconciler(
+			fluxtenantcredential.WithClient(c),
+			fluxtenantcredential.WithLogger(logr.Discard()),
+			fluxtenantcredential.WithIssuer(issuer),
+		),
+	}, nil
+}
+
+// proxyCA returns the Certificate Authority used by Capsule Proxy, read from the file, if set, or from the Secret.
+func (o *Options) proxyCA(ctx context.Context, reader client.Reader) ([]byte, error) {
+	if o.ProxyCAPath != "" {
+		proxyCA, err := os.ReadFile(o.ProxyCAPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read the CA file")
+		}
+
+		return proxyCA, nil
+	}
+
+	namespace, name, ok := strings.Cut(o.ProxyCASecret, "/")
+	if !ok {
+		return nil, errors.Errorf("invalid Capsule Proxy Secret %q, expected namespace/name", o.ProxyCASecret)
+	}
+
+	secret := new(corev1.Secret)
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		return nil, errors.Wrap(err, "unable to get the Capsule Proxy Secret")
+	}
+
+	proxyCA, ok := secret.Data[o.ProxyCAKey]
+	if !ok {
+		return nil, errors.Errorf("key %q not found in the Capsule Proxy Secret %s", o.ProxyCAKey, o.ProxyCASecret)
+	}
+
+	return proxyCA, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	"github.com/projectcapsule/capsule-addon-flux/pkg/indexer"
+)
+
+// indexedClient serves the lists matching the fields of the indexers with an uncached client: the API server does not
+// know these fields, so the objects are listed by the other options, such as the namespace and the labels, and
+// filtered with the indexer functions.
+type indexedClient struct {
+	client.Client
+
+	indexers map[schema.GroupVersionKind]map[string]client.IndexerFunc
+}
+
+// newIndexedClient returns the client serving the fields of the indexers registered.
+func newIndexedClient(c client.Client) *indexedClient {
+	return &indexedClient{Client: c, indexers: make(map[schema.GroupVersionKind]map[string]client.IndexerFunc)}
+}
+
+// register registers the indexers, serving their fields.
+func (c *indexedClient) register(indexers ...indexer.CustomIndexer) error {
+	for _, idx := range indexers {
+		gvk, err := apiutil.GVKForObject(idx.Object(), c.Scheme())
+		if err != nil {
+			return err
+		}
+
+		if c.indexers[gvk] == nil {
+			c.indexers[gvk] = make(map[string]client.IndexerFunc)
+		}
+
+		c.indexers[gvk][idx.Field()] = idx.Func()
+	}
+
+	return nil
+}
+
+func (c *indexedClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := (&client.ListOptions{}).ApplyOptions(opts)
+	if listOpts.FieldSelector == nil || listOpts.FieldSelector.Empty() {
+		return c.Client.List(ctx, list, opts...)
+	}
+
+	gvk, err := apiutil.GVKForObject(list, c.Scheme())
+	if err != nil {
+		return err
+	}
+
+	funcs := c.indexers[gvk.GroupVersion().WithKind(strings.TrimSuffix(gvk.Kind, "List"))]
+
+	requirements := listOpts.FieldSelector.Requirements()
+	for _, requirement := range requirements {
+		// The fields not indexed, such as metadata.name, are served by the API server.
+		if _, ok := funcs[requirement.Field]; !ok || requirement.Operator == selection.NotEquals {
+			return c.Client.List(ctx, list, opts...)
+		}
+	}
+
+	listOpts.FieldSelector = nil
+
+	if err = c.Client.List(ctx, list, listOpts); err != nil {
+		return err
+	}
+
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+
+	filtered := make([]runtime.Object, 0, len(items))
+
+	for _, item := range items {
+		obj, ok := item.(client.Object)
+		if !ok {
+			continue
+		}
+
+		if matches(obj, funcs, requirements) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	return meta.SetList(list, filtered)
+}
+
+// matches returns true if the values indexed for the object satisfy all the field requirements.
+func matches(obj client.Object, funcs map[string]client.IndexerFunc, requirements fields.Requirements) bool {
+	for _, requirement := range requirements {
+		if !slices.Contains(funcs[requirement.Field](obj), requirement.Value) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,104 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package cli
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/indexer"
+)
+
+func TestIndexedClient(t *testing.T) {
+	scheme, err := NewScheme()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newCredential := func(namespace, name, serviceAccountName string, labels map[string]string) *v1alpha1.FluxTenantCredential {
+		return &v1alpha1.FluxTenantCredential{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: labels},
+			Spec:       v1alpha1.FluxTenantCredentialSpec{ServiceAccountName: serviceAccountName},
+		}
+	}
+
+	// The fake client is built without indexes, as the API server does not know the indexed fields.
+	c := newIndexedClient(fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newCredential("oil-system", "oil", "gitops-reconciler", map[string]string{"team": "oil"}),
+		newCredential("oil-system", "oil-staging", "gitops-reconciler", nil),
+		newCredential("oil-system", "other", "other-reconciler", map[string]string{"team": "oil"}),
+		newCredential("gas-system", "gas", "gitops-reconciler", nil),
+	).Build())
+
+	if err = c.register(indexer.FluxTenantCredentialServiceAccount{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		opts  []client.ListOption
+		names []string
+		err   bool
+	}{
+		{name: "no field", opts: []client.ListOption{client.InNamespace("oil-system")}, names: []string{"oil", "oil-staging", "other"}},
+		{
+			name:  "indexed field",
+			opts:  []client.ListOption{client.MatchingFields{indexer.FluxTenantCredentialServiceAccountField: "gitops-reconciler"}},
+			names: []string{"gas", "oil", "oil-staging"},
+		},
+		{
+			name: "indexed field in namespace",
+			opts: []client.ListOption{
+				client.InNamespace("oil-system"),
+				client.MatchingFields{indexer.FluxTenantCredentialServiceAccountField: "gitops-reconciler"},
+			},
+			names: []string{"oil", "oil-staging"},
+		},
+		{
+			name: "indexed field with labels",
+			opts: []client.ListOption{
+				client.MatchingLabels{"team": "oil"},
+				client.MatchingFields{indexer.FluxTenantCredentialServiceAccountField: "gitops-reconciler"},
+			},
+			names: []string{"oil"},
+		},
+		{name: "field not indexed", opts: []client.ListOption{client.MatchingFields{".spec.mode": "Impersonation"}}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ftcList := new(v1alpha1.FluxTenantCredentialList)
+
+			err := c.List(context.Background(), ftcList, tt.opts...)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			names := make([]string, 0, len(ftcList.Items))
+			for _, ftc := range ftcList.Items {
+				names = append(names, ftc.Name)
+			}
+
+			slices.Sort(names)
+
+			if !slices.Equal(names, tt.names) {
+				t.Fatalf("expected the FluxTenantCredentials %v, got %v", tt.names, names)
+			}
+		})
+	}
+}
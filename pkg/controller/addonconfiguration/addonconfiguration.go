@@ -0,0 +1,119 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package addonconfiguration
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+)
+
+//nolint:revive
+type AddonConfigurationReconciler struct {
+	configurationName string
+
+	Client client.Client
+	Log    logr.Logger
+}
+
+type Option func(r *AddonConfigurationReconciler)
+
+func WithClient(c client.Client) Option {
+	return func(r *AddonConfigurationReconciler) {
+		r.Client = c
+	}
+}
+
+func WithLogger(log logr.Logger) Option {
+	return func(r *AddonConfigurationReconciler) {
+		r.Log = log
+	}
+}
+
+// WithConfigurationName sets the name of the AddonConfiguration in use by the addon.
+func WithConfigurationName(name string) Option {
+	return func(r *AddonConfigurationReconciler) {
+		r.configurationName = name
+	}
+}
+
+func NewAddonConfigurationReconciler(opts ...Option) *AddonConfigurationReconciler {
+	reconciler := new(AddonConfigurationReconciler)
+
+	for _, f := range opts {
+		f(reconciler)
+	}
+
+	return reconciler
+}
+
+func (r *AddonConfigurationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.AddonConfiguration{}).
+		Complete(r)
+}
+
+func (r *AddonConfigurationReconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("Request.Name", request.Name)
+
+	cfg := new(v1alpha1.AddonConfiguration)
+	if err := r.Client.Get(ctx, request.NamespacedName, cfg); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("Request object not found, could have been deleted after reconcile request")
+
+			return reconcile.Result{}, nil
+		}
+
+		log.Error(err, "Error reading the object")
+
+		return reconcile.Result{}, err
+	}
+
+	condition := metav1.Condition{
+		Type:               v1alpha1.ReadyCondition,
+		ObservedGeneration: cfg.Generation,
+	}
+
+	switch errs := Validate(cfg); {
+	case len(errs) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = v1alpha1.InvalidReason
+		condition.Message = errs.ToAggregate().Error()
+	case cfg.Name == r.configurationName:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = v1alpha1.ActiveReason
+		condition.Message = "The configuration is in use"
+	default:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = v1alpha1.InactiveReason
+		condition.Message = fmt.Sprintf("The configuration is valid, but the addon uses the %s one", r.configurationName)
+	}
+
+	// The last valid specification is kept, to be used by the addon until the current one is fixed.
+	if condition.Status == metav1.ConditionTrue {
+		cfg.Status.ValidatedSpec = cfg.Spec.DeepCopy()
+	}
+
+	meta.SetStatusCondition(&cfg.Status.Conditions, condition)
+	cfg.Status.Active = condition.Reason == v1alpha1.ActiveReason
+	cfg.Status.ObservedGeneration = cfg.Generation
+
+	if err := r.Client.Status().Update(ctx, cfg); err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "error updating the AddonConfiguration status")
+	}
+
+	log.Info("AddonConfiguration reconciliation completed", "reason", condition.Reason)
+
+	return reconcile.Result{}, nil
+}
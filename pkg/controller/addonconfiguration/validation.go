@@ -0,0 +1,105 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package addonconfiguration
+
+import (
+	"net/url"
+
+	"k8s.io/apimachinery/pkg/api/validation/path"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/serviceaccount"
+)
+
+// minTokenExpirationSeconds is the minimum lifetime accepted by the TokenRequest API.
+const minTokenExpirationSeconds = 600
+
+// sampleServiceAccountName is used to validate the kubeConfig Secret name templates.
+const sampleServiceAccountName = "serviceaccount"
+
+// Validate returns the errors of the AddonConfiguration, beyond the ones caught by the OpenAPI schema.
+func Validate(cfg *v1alpha1.AddonConfiguration) field.ErrorList {
+	specPath := field.NewPath("spec")
+
+	errs := validateDefaults(specPath, cfg.Spec.AddonDefaults)
+
+	if allowed := cfg.Spec.AllowedTenants; allowed != nil && allowed.Selector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(allowed.Selector); err != nil {
+			errs = append(errs, field.Invalid(specPath.Child("allowedTenants", "selector"), allowed.Selector, err.Error()))
+		}
+	}
+
+	for i, proxyURL := range cfg.Spec.AllowedProxyURLs {
+		errs = append(errs, validateProxyURL(specPath.Child("allowedProxyURLs").Index(i), proxyURL)...)
+	}
+
+	for i, override := range cfg.Spec.Overrides {
+		overridePath := specPath.Child("overrides").Index(i)
+
+		if _, err := metav1.LabelSelectorAsSelector(&override.TenantSelector); err != nil {
+			errs = append(errs, field.Invalid(overridePath.Child("tenantSelector"), override.TenantSelector, err.Error()))
+		}
+
+		errs = append(errs, validateDefaults(overridePath, override.AddonDefaults)...)
+	}
+
+	return errs
+}
+
+func validateDefaults(fldPath *field.Path, defaults v1alpha1.AddonDefaults) field.ErrorList {
+	var errs field.ErrorList
+
+	if defaults.Proxy != nil && defaults.Proxy.URL != "" {
+		errs = append(errs, validateProxyURL(fldPath.Child("proxy", "url"), defaults.Proxy.URL)...)
+	}
+
+	if defaults.RBAC != nil && defaults.RBAC.ClusterRoleName != "" {
+		for _, msg := range path.IsValidPathSegmentName(defaults.RBAC.ClusterRoleName) {
+			errs = append(errs, field.Invalid(fldPath.Child("rbac", "clusterRoleName"), defaults.RBAC.ClusterRoleName, msg))
+		}
+	}
+
+	if defaults.Secret != nil {
+		if template := defaults.Secret.NameTemplate; template != "" {
+			for _, msg := range validation.IsDNS1123Subdomain(serviceaccount.SecretName(template, sampleServiceAccountName)) {
+				errs = append(errs, field.Invalid(fldPath.Child("secret", "nameTemplate"), template, msg))
+			}
+		}
+
+		if key := defaults.Secret.Key; key != "" {
+			for _, msg := range validation.IsConfigMapKey(key) {
+				errs = append(errs, field.Invalid(fldPath.Child("secret", "key"), key, msg))
+			}
+		}
+	}
+
+	if defaults.Notification != nil && defaults.Notification.AddressAnnotation != "" {
+		for _, msg := range validation.IsQualifiedName(defaults.Notification.AddressAnnotation) {
+			errs = append(errs, field.Invalid(fldPath.Child("notification", "addressAnnotation"), defaults.Notification.AddressAnnotation, msg))
+		}
+	}
+
+	if defaults.TokenPolicy != nil && defaults.TokenPolicy.ExpirationSeconds != nil && *defaults.TokenPolicy.ExpirationSeconds < minTokenExpirationSeconds {
+		errs = append(errs, field.Invalid(fldPath.Child("tokenPolicy", "expirationSeconds"), *defaults.TokenPolicy.ExpirationSeconds, "must be at least 600 seconds"))
+	}
+
+	return errs
+}
+
+// validateProxyURL returns the errors of a Capsule Proxy URL, which must be an absolute http(s) one.
+func validateProxyURL(fldPath *field.Path, proxyURL string) field.ErrorList {
+	u, err := url.Parse(proxyURL)
+
+	switch {
+	case err != nil:
+		return field.ErrorList{field.Invalid(fldPath, proxyURL, err.Error())}
+	case u.Scheme != "https" && u.Scheme != "http", u.Host == "":
+		return field.ErrorList{field.Invalid(fldPath, proxyURL, "must be an absolute http(s) URL")}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package addonconfiguration
+
+import (
+	"slices"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+)
+
+func TestValidate(t *testing.T) {
+	shortExpiration, expiration := int64(60), int64(3600)
+	invalidSelector := &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "gitops", Operator: "Unknown"}},
+	}
+
+	tests := []struct {
+		name   string
+		spec   v1alpha1.AddonConfigurationSpec
+		fields []string
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "valid",
+			spec: v1alpha1.AddonConfigurationSpec{
+				AddonDefaults: v1alpha1.AddonDefaults{
+					Proxy:        &v1alpha1.ProxySpec{URL: "https://capsule-proxy.capsule-system.svc:9001"},
+					TokenPolicy:  &v1alpha1.TokenPolicySpec{Type: v1alpha1.TokenRequestType, ExpirationSeconds: &expiration},
+					RBAC:         &v1alpha1.RBACSpec{ClusterRoleName: "cluster-admin"},
+					Secret:       &v1alpha1.SecretNamingSpec{NameTemplate: "{name}-kubeconfig", Key: "kubeconfig"},
+					Notification: &v1alpha1.NotificationSpec{AddressAnnotation: "example.com/address"},
+				},
+				AllowedTenants: &v1alpha1.AllowedTenantsSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"gitops": "enabled"}},
+				},
+				Overrides: []v1alpha1.TenantOverride{{
+					TenantSelector: metav1.LabelSelector{MatchLabels: map[string]string{"environment": "production"}},
+				}},
+			},
+		},
+		{
+			name: "relative proxy url",
+			spec: v1alpha1.AddonConfigurationSpec{
+				AddonDefaults: v1alpha1.AddonDefaults{Proxy: &v1alpha1.ProxySpec{URL: "capsule-proxy:9001"}},
+			},
+			fields: []string{"spec.proxy.url"},
+		},
+		{
+			name: "unsupported proxy url scheme",
+			spec: v1alpha1.AddonConfigurationSpec{
+				AddonDefaults: v1alpha1.AddonDefaults{Proxy: &v1alpha1.ProxySpec{URL: "ftp://capsule-proxy:9001"}},
+			},
+			fields: []string{"spec.proxy.url"},
+		},
+		{
+			name: "invalid allowed proxy url",
+			spec: v1alpha1.AddonConfigurationSpec{
+				AllowedProxyURLs: []string{"https://capsule-proxy.example.com", "capsule-proxy.example.com"},
+			},
+			fields: []string{"spec.allowedProxyURLs[1]"},
+		},
+		{
+			name: "invalid cluster role name",
+			spec: v1alpha1.AddonConfigurationSpec{
+				AddonDefaults: v1alpha1.AddonDefaults{RBAC: &v1alpha1.RBACSpec{ClusterRoleName: "cluster/admin"}},
+			},
+			fields: []string{"spec.rbac.clusterRoleName"},
+		},
+		{
+			name: "invalid secret naming",
+			spec: v1alpha1.AddonConfigurationSpec{
+				AddonDefaults: v1alpha1.AddonDefaults{Secret: &v1alpha1.SecretNamingSpec{NameTemplate: "{name}_Kubeconfig", Key: "kube config"}},
+			},
+			fields: []string{"spec.secret.nameTemplate", "spec.secret.key"},
+		},
+		{
+			name: "invalid notification address annotation",
+			spec: v1alpha1.AddonConfigurationSpec{
+				AddonDefaults: v1alpha1.AddonDefaults{Notification: &v1alpha1.NotificationSpec{AddressAnnotation: "example.com/a/b"}},
+			},
+			fields: []string{"spec.notification.addressAnnotation"},
+		},
+		{
+			name: "short token expiration",
+			spec: v1alpha1.AddonConfigurationSpec{
+				AddonDefaults: v1alpha1.AddonDefaults{TokenPolicy: &v1alpha1.TokenPolicySpec{Type: v1alpha1.TokenRequestType, ExpirationSeconds: &shortExpiration}},
+			},
+			fields: []string{"spec.tokenPolicy.expirationSeconds"},
+		},
+		{
+			name: "invalid allowed tenants selector",
+			spec: v1alpha1.AddonConfigurationSpec{
+				AllowedTenants: &v1alpha1.AllowedTenantsSpec{Selector: invalidSelector},
+			},
+			fields: []string{"spec.allowedTenants.selector"},
+		},
+		{
+			name: "invalid override",
+			spec: v1alpha1.AddonConfigurationSpec{
+				Overrides: []v1alpha1.TenantOverride{
+					{TenantSelector: metav1.LabelSelector{MatchLabels: map[string]string{"environment": "staging"}}},
+					{
+						TenantSelector: *invalidSelector,
+						AddonDefaults:  v1alpha1.AddonDefaults{TokenPolicy: &v1alpha1.TokenPolicySpec{ExpirationSeconds: &shortExpiration}},
+					},
+				},
+			},
+			fields: []string{"spec.overrides[1].tenantSelector", "spec.overrides[1].tokenPolicy.expirationSeconds"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := Validate(&v1alpha1.AddonConfiguration{Spec: tt.spec})
+
+			fields := make([]string, 0, len(errs))
+			for _, err := range errs {
+				fields = append(fields, err.Field)
+			}
+
+			if !slices.Equal(fields, tt.fields) {
+				t.Fatalf("expected the errors on %v, got %v", tt.fields, errs)
+			}
+		})
+	}
+}
@@ -0,0 +1,431 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package fluxtenantcredential
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/serviceaccount"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/indexer"
+)
+
+//nolint:revive
+type FluxTenantCredentialReconciler struct {
+	issuer *serviceaccount.ServiceAccountReconciler
+
+	Client client.Client
+	Log    logr.Logger
+}
+
+type Option func(r *FluxTenantCredentialReconciler)
+
+func WithClient(c client.Client) Option {
+	return func(r *FluxTenantCredentialReconciler) {
+		r.Client = c
+	}
+}
+
+func WithLogger(log logr.Logger) Option {
+	return func(r *FluxTenantCredentialReconciler) {
+		r.Log = log
+	}
+}
+
+// WithIssuer sets the ServiceAccount reconciler issuing the credentials, shared with the annotations shorthand.
+func WithIssuer(issuer *serviceaccount.ServiceAccountReconciler) Option {
+	return func(r *FluxTenantCredentialReconciler) {
+		r.issuer = issuer
+	}
+}
+
+func NewFluxTenantCredentialReconciler(opts ...Option) *FluxTenantCredentialReconciler {
+	reconciler := new(FluxTenantCredentialReconciler)
+
+	for _, f := range opts {
+		f(reconciler)
+	}
+
+	return reconciler
+}
+
+func (r *FluxTenantCredentialReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	bldr := ctrl.NewControllerManagedBy(mgr)
+
+	for _, gvk := range append(r.issuer.BootstrapGroupVersionKinds(), r.issuer.NotificationGroupVersionKinds()...) {
+		obj := new(unstructured.Unstructured)
+		obj.SetGroupVersionKind(gvk)
+
+		bldr = bldr.Watches(obj, handler.EnqueueRequestsFromMapFunc(r.credentialsForObject))
+	}
+
+	for _, obj := range serviceaccount.GeneratedObjects() {
+		bldr = bldr.Watches(obj, handler.EnqueueRequestsFromMapFunc(r.credentialsForObject))
+	}
+
+	return bldr.
+		For(&v1alpha1.FluxTenantCredential{}).
+		Watches(&corev1.ServiceAccount{}, handler.EnqueueRequestsFromMapFunc(r.credentialsForServiceAccount)).
+		Watches(&capsulev1beta2.Tenant{}, handler.EnqueueRequestsFromMapFunc(r.allCredentials)).
+		Watches(&v1alpha1.AddonConfiguration{}, handler.EnqueueRequestsFromMapFunc(r.allCredentials)).
+		Complete(r)
+}
+
+func (r *FluxTenantCredentialReconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("Request.NamespacedName", request.NamespacedName)
+	// The issuer is shared with the ServiceAccount controller: the logger of the request is carried by the context.
+	ctx = logr.NewContext(ctx, log)
+
+	ftc := new(v1alpha1.FluxTenantCredential)
+	if err := r.Client.Get(ctx, request.NamespacedName, ftc); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("Request object not found, could have been deleted after reconcile request")
+
+			return reconcile.Result{}, nil
+		}
+
+		log.Error(err, "Error reading the object")
+
+		return reconcile.Result{}, err
+	}
+
+	result, reconcileErr := r.reconcile(ctx, ftc)
+
+	// In the dry-run mode, the status is not updated, since it would report credentials not issued.
+	if !r.issuer.DryRun() {
+		ftc.Status.ObservedGeneration = ftc.Generation
+		if err := r.Client.Status().Update(ctx, ftc); err != nil {
+			return reconcile.Result{}, errors.Wrap(err, "error updating the FluxTenantCredential status")
+		}
+	}
+
+	if reconcileErr != nil {
+		return reconcile.Result{}, reconcileErr
+	}
+
+	log.Info("FluxTenantCredential reconciliation completed")
+
+	return result, nil
+}
+
+// reconcile issues the credential and reflects its outcome in the status of the FluxTenantCredential.
+func (r *FluxTenantCredentialReconciler) reconcile(ctx context.Context, ftc *v1alpha1.FluxTenantCredential) (reconcile.Result, error) {
+	sa := new(corev1.ServiceAccount)
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: ftc.Namespace, Name: ftc.Spec.ServiceAccountName}, sa); err != nil {
+		if apierrors.IsNotFound(err) {
+			setReady(ftc, metav1.ConditionFalse, v1alpha1.ServiceAccountNotFoundReason, fmt.Sprintf("ServiceAccount %s not found", ftc.Spec.ServiceAccountName))
+
+			return reconcile.Result{}, nil
+		}
+
+		return reconcile.Result{}, err
+	}
+
+	active, err := r.activeCredential(ctx, ftc)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if active.Name != ftc.Name {
+		setReady(ftc, metav1.ConditionFalse, v1alpha1.ConflictReason, fmt.Sprintf("ServiceAccount %s is managed by FluxTenantCredential %s", sa.Name, active.Name))
+
+		return reconcile.Result{}, nil
+	}
+
+	// Skip all the writes while the reconciliation is paused, keeping the Ready condition as it is.
+	message, err := r.issuer.Paused(ctx, sa)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+
+	if message != "" {
+		logr.FromContextOrDiscard(ctx).Info("Reconciliation is paused", "reason", message)
+
+		meta.SetStatusCondition(&ftc.Status.Conditions, metav1.Condition{
+			Type:               v1alpha1.PausedCondition,
+			Status:             metav1.ConditionTrue,
+			Reason:             v1alpha1.PausedReason,
+			Message:            message,
+			ObservedGeneration: ftc.Generation,
+		})
+
+		return reconcile.Result{}, nil
+	}
+
+	meta.RemoveStatusCondition(&ftc.Status.Conditions, v1alpha1.PausedCondition)
+
+	settings, err := r.settings(ctx, sa, ftc)
+
+	switch {
+	case errors.Is(err, serviceaccount.ErrConfigurationNotValidated):
+		setReady(ftc, metav1.ConditionFalse, v1alpha1.ConfigurationPendingReason, err.Error())
+
+		return reconcile.Result{Requeue: true}, nil
+	case errors.Is(err, serviceaccount.ErrProxyURLNotAllowed):
+		setReady(ftc, metav1.ConditionFalse, v1alpha1.ProxyURLNotAllowedReason, err.Error())
+
+		return reconcile.Result{}, nil
+	case err != nil:
+		setReady(ftc, metav1.ConditionFalse, v1alpha1.FailedReason, err.Error())
+
+		return reconcile.Result{}, err
+	}
+
+	credential, err := r.issuer.Issue(ctx, sa, settings)
+
+	switch {
+	case errors.Is(err, serviceaccount.ErrServiceAccountNotTenantOwner):
+		setReady(ftc, metav1.ConditionFalse, v1alpha1.NotTenantOwnerReason, err.Error())
+
+		return reconcile.Result{}, nil
+	case errors.Is(err, serviceaccount.ErrServiceAccountTokenSecretEmpty):
+		setReady(ftc, metav1.ConditionFalse, v1alpha1.TokenPendingReason, err.Error())
+
+		return reconcile.Result{Requeue: true}, nil
+	case errors.Is(err, serviceaccount.ErrProxyVerificationFailed):
+		setProxyVerified(ftc, metav1.ConditionFalse, v1alpha1.ProxyVerificationFailedReason, err.Error())
+		setReady(ftc, metav1.ConditionFalse, v1alpha1.ProxyVerificationFailedReason, err.Error())
+
+		return reconcile.Result{Requeue: true}, nil
+	case err != nil:
+		setReady(ftc, metav1.ConditionFalse, v1alpha1.FailedReason, err.Error())
+
+		return reconcile.Result{}, err
+	}
+
+	ftc.Status.SecretName = credential.SecretName
+	ftc.Status.Tenants = credential.Tenants
+	ftc.Status.DistributedNamespaces = credential.DistributedNamespaces
+	ftc.Status.TokenExpirationTimestamp = nil
+
+	if !credential.TokenExpiration.IsZero() {
+		ftc.Status.TokenExpirationTimestamp = &metav1.Time{Time: credential.TokenExpiration}
+	}
+
+	if credential.ProxyVerified {
+		setProxyVerified(ftc, metav1.ConditionTrue, v1alpha1.VerifiedReason, "The kubeConfig authenticates the ServiceAccount through the Capsule Proxy")
+	} else {
+		meta.RemoveStatusCondition(&ftc.Status.Conditions, v1alpha1.ProxyVerifiedCondition)
+	}
+
+	if credential.SecretName == "" {
+		setReady(ftc, metav1.ConditionTrue, v1alpha1.IssuedReason, "The impersonation has been granted to the Flux controllers")
+	} else {
+		setReady(ftc, metav1.ConditionTrue, v1alpha1.IssuedReason, "The kubeConfig has been issued")
+	}
+
+	return reconcile.Result{RequeueAfter: credential.RequeueAfter}, nil
+}
+
+// ServiceAccountSettings returns the credential Settings of the ServiceAccount, as specified by the active
+// FluxTenantCredential referring it, if any, or by its annotations otherwise.
+func (r *FluxTenantCredentialReconciler) ServiceAccountSettings(ctx context.Context, sa *corev1.ServiceAccount) (serviceaccount.Settings, error) {
+	ftcList := new(v1alpha1.FluxTenantCredentialList)
+	if err := r.Client.List(ctx, ftcList, client.InNamespace(sa.Namespace), client.MatchingFields{
+		indexer.FluxTenantCredentialServiceAccountField: sa.Name,
+	}); err != nil {
+		return serviceaccount.Settings{}, errors.Wrap(err, "error listing FluxTenantCredentials for service account")
+	}
+
+	if len(ftcList.Items) == 0 {
+		return r.issuer.AnnotationSettings(ctx, sa)
+	}
+
+	active, err := r.activeCredential(ctx, &ftcList.Items[0])
+	if err != nil {
+		return serviceaccount.Settings{}, err
+	}
+
+	return r.settings(ctx, sa, active)
+}
+
+// settings returns the credential Settings, as specified by the FluxTenantCredential on top of the defaults.
+func (r *FluxTenantCredentialReconciler) settings(ctx context.Context, sa *corev1.ServiceAccount, ftc *v1alpha1.FluxTenantCredential) (serviceaccount.Settings, error) {
+	settings, err := r.issuer.DefaultSettings(ctx, sa)
+	if err != nil {
+		return settings, err
+	}
+
+	if ftc.Spec.Tenant != "" {
+		settings.Tenants = []string{ftc.Spec.Tenant}
+	}
+
+	if ftc.Spec.Mode != "" {
+		settings.Mode = string(ftc.Spec.Mode)
+	}
+
+	if ftc.Spec.Proxy != nil && ftc.Spec.Proxy.URL != "" && ftc.Spec.Proxy.URL != settings.ProxyURL {
+		if !slices.Contains(settings.AllowedProxyURLs, ftc.Spec.Proxy.URL) {
+			return settings, errors.Wrapf(serviceaccount.ErrProxyURLNotAllowed, "proxy URL %s", ftc.Spec.Proxy.URL)
+		}
+
+		settings.ProxyURL = ftc.Spec.Proxy.URL
+	}
+
+	if ftc.Spec.RBAC != nil && ftc.Spec.RBAC.ClusterRoleName != "" {
+		settings.ClusterRoleName = ftc.Spec.RBAC.ClusterRoleName
+	}
+
+	if ftc.Spec.Secret != nil {
+		if ftc.Spec.Secret.Name != "" {
+			settings.SecretName = ftc.Spec.Secret.Name
+		}
+
+		if ftc.Spec.Secret.Key != "" {
+			settings.SecretKey = ftc.Spec.Secret.Key
+		}
+	}
+
+	if ftc.Spec.Distribution != nil {
+		switch ftc.Spec.Distribution.Kind {
+		case v1alpha1.GlobalTenantResourceDistribution:
+			settings.Distribution = serviceaccount.DistributionGlobalTenantResource
+		case v1alpha1.TenantResourceDistribution:
+			settings.Distribution = serviceaccount.DistributionTenantResource
+		case v1alpha1.NoDistribution:
+			settings.Distribution = ""
+		}
+
+		settings.DistributionTenants = ftc.Spec.Distribution.Tenants
+	}
+
+	if ftc.Spec.Bootstrap != nil {
+		settings.Bootstrap = bootstrap(ftc.Spec.Bootstrap)
+	}
+
+	if ftc.Spec.TokenPolicy != nil {
+		settings.TokenExpiration = serviceaccount.TokenExpiration(settings.TokenExpiration, *ftc.Spec.TokenPolicy)
+	}
+
+	return settings, nil
+}
+
+// bootstrap returns the Bootstrap specified by the FluxTenantCredential.
+func bootstrap(spec *v1alpha1.BootstrapSpec) *serviceaccount.Bootstrap {
+	sourceKind := string(spec.SourceKind)
+	if sourceKind == "" {
+		sourceKind = string(v1alpha1.GitRepositorySource)
+	}
+
+	out := serviceaccount.NewBootstrap(sourceKind)
+	out.URL = spec.URL
+
+	if spec.Branch != "" {
+		out.Branch = spec.Branch
+	}
+
+	if spec.Tag != "" {
+		out.Tag = spec.Tag
+	}
+
+	if spec.Path != "" {
+		out.Path = spec.Path
+	}
+
+	if spec.Bucket != nil {
+		out.Bucket = serviceaccount.BootstrapBucket{
+			Name:     spec.Bucket.Name,
+			Endpoint: spec.Bucket.Endpoint,
+			Provider: spec.Bucket.Provider,
+			Region:   spec.Bucket.Region,
+		}
+
+		if out.Bucket.Provider == "" {
+			out.Bucket.Provider = serviceaccount.DefaultBootstrapBucketProvider
+		}
+	}
+
+	if spec.SecretRef != nil {
+		out.SecretName = spec.SecretRef.Name
+	}
+
+	if spec.Verify != nil {
+		out.Verify = &serviceaccount.BootstrapVerification{
+			Provider: spec.Verify.Provider,
+			Mode:     spec.Verify.Mode,
+		}
+
+		if spec.Verify.SecretRef != nil {
+			out.Verify.SecretName = spec.Verify.SecretRef.Name
+		}
+
+		for _, identity := range spec.Verify.MatchOIDCIdentity {
+			out.Verify.MatchOIDCIdentity = append(out.Verify.MatchOIDCIdentity, serviceaccount.BootstrapOIDCIdentity{
+				Issuer:  identity.Issuer,
+				Subject: identity.Subject,
+			})
+		}
+	}
+
+	if spec.Interval != nil {
+		out.KustomizationInterval = spec.Interval.Duration
+	}
+
+	return out
+}
+
+// activeCredential returns, among the FluxTenantCredentials referring to the same ServiceAccount, the one managing
+// it: that is the oldest one.
+func (r *FluxTenantCredentialReconciler) activeCredential(ctx context.Context, ftc *v1alpha1.FluxTenantCredential) (*v1alpha1.FluxTenantCredential, error) {
+	ftcList := new(v1alpha1.FluxTenantCredentialList)
+	if err := r.Client.List(ctx, ftcList, client.InNamespace(ftc.Namespace), client.MatchingFields{
+		indexer.FluxTenantCredentialServiceAccountField: ftc.Spec.ServiceAccountName,
+	}); err != nil {
+		return nil, err
+	}
+
+	if len(ftcList.Items) == 0 {
+		return ftc, nil
+	}
+
+	sort.Slice(ftcList.Items, func(i, j int) bool {
+		a, b := ftcList.Items[i], ftcList.Items[j]
+		if !a.CreationTimestamp.Equal(&b.CreationTimestamp) {
+			return a.CreationTimestamp.Before(&b.CreationTimestamp)
+		}
+
+		return a.Name < b.Name
+	})
+
+	return &ftcList.Items[0], nil
+}
+
+// setReady sets the Ready condition of the FluxTenantCredential.
+func setReady(ftc *v1alpha1.FluxTenantCredential, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&ftc.Status.Conditions, metav1.Condition{
+		Type:               v1alpha1.ReadyCondition,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: ftc.Generation,
+	})
+}
+
+// setProxyVerified sets the ProxyVerified condition of the FluxTenantCredential.
+func setProxyVerified(ftc *v1alpha1.FluxTenantCredential, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&ftc.Status.Conditions, metav1.Condition{
+		Type:               v1alpha1.ProxyVerifiedCondition,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: ftc.Generation,
+	})
+}
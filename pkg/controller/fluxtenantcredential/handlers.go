@@ -0,0 +1,76 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package fluxtenantcredential
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/controller/serviceaccount"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/indexer"
+)
+
+// credentialsForServiceAccount maps a ServiceAccount to the FluxTenantCredentials referring to it.
+func (r *FluxTenantCredentialReconciler) credentialsForServiceAccount(ctx context.Context, object client.Object) []reconcile.Request {
+	return r.credentialsFor(ctx, object.GetNamespace(), object.GetName())
+}
+
+// credentialsForObject maps an object generated by the addon to the FluxTenantCredentials referring to the
+// ServiceAccount it originates from.
+func (r *FluxTenantCredentialReconciler) credentialsForObject(ctx context.Context, object client.Object) []reconcile.Request {
+	labels := object.GetLabels()
+
+	if labels[serviceaccount.LabelManagedBy] != serviceaccount.ManagerName {
+		return nil
+	}
+
+	return r.credentialsFor(ctx, labels[serviceaccount.LabelServiceAccountNamespace], labels[serviceaccount.LabelServiceAccountName])
+}
+
+// allCredentials maps an object to all the FluxTenantCredentials, such as for Tenant ownership changes.
+func (r *FluxTenantCredentialReconciler) allCredentials(ctx context.Context, _ client.Object) []reconcile.Request {
+	ftcList := new(v1alpha1.FluxTenantCredentialList)
+	if err := r.Client.List(ctx, ftcList); err != nil {
+		r.Log.Error(err, "Error listing FluxTenantCredentials")
+
+		return nil
+	}
+
+	return toRequests(ftcList)
+}
+
+// credentialsFor returns the requests for the FluxTenantCredentials referring to the ServiceAccount of which the
+// namespace and the name are specified as arguments.
+func (r *FluxTenantCredentialReconciler) credentialsFor(ctx context.Context, namespace, name string) []reconcile.Request {
+	if namespace == "" || name == "" {
+		return nil
+	}
+
+	ftcList := new(v1alpha1.FluxTenantCredentialList)
+	if err := r.Client.List(ctx, ftcList, client.InNamespace(namespace), client.MatchingFields{
+		indexer.FluxTenantCredentialServiceAccountField: name,
+	}); err != nil {
+		r.Log.Error(err, "Error listing FluxTenantCredentials for ServiceAccount", "namespace", namespace, "name", name)
+
+		return nil
+	}
+
+	return toRequests(ftcList)
+}
+
+func toRequests(ftcList *v1alpha1.FluxTenantCredentialList) []reconcile.Request {
+	requests := make([]reconcile.Request, 0, len(ftcList.Items))
+
+	for _, ftc := range ftcList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: ftc.Namespace, Name: ftc.Name},
+		})
+	}
+
+	return requests
+}
@@ -0,0 +1,182 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	"github.com/projectcapsule/capsule-addon-flux/pkg/metrics"
+)
+
+// apply applies the desired state of the object with server-side apply, as the FieldManager: only the fields set in
+// the object are owned by the addon, while the other ones are left to their managers.
+// The conflicts with the other managers on the owned fields are reported on the ServiceAccount, before forcing the
+// ownership. The object is updated with the applied state.
+// In the dry-run mode, the changes are reported instead of being applied.
+func (r *ServiceAccountReconciler) apply(ctx context.Context, sa *corev1.ServiceAccount, obj client.Object) error {
+	gvk, err := apiutil.GVKForObject(obj, r.Client.Scheme())
+	if err != nil {
+		return err
+	}
+
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	obj.SetManagedFields(nil)
+	obj.SetResourceVersion("")
+
+	if r.isDryRun(ctx) {
+		return r.planApply(ctx, sa, gvk, obj)
+	}
+
+	err = r.Client.Patch(ctx, obj, client.Apply, client.FieldOwner(FieldManager))
+	if !apierrors.IsConflict(err) {
+		return err
+	}
+
+	r.recordConflict(ctx, sa, gvk.Kind, obj, err)
+
+	// The kind is set again, in case the failed request reset it.
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+
+	return r.Client.Patch(ctx, obj, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership)
+}
+
+// ensure applies the desired state of the object, generated for the ServiceAccount and tied back to the origin carried
+// by the context, recording the correction of the existing object when its labels, or the fields tracked with the
+// function specified, drifted from the desired ones.
+func (r *ServiceAccountReconciler) ensure(ctx context.Context, sa *corev1.ServiceAccount, desired client.Object, track func(current client.Object, drift *driftTracker)) error {
+	gvk, err := apiutil.GVKForObject(desired, r.Client.Scheme())
+	if err != nil {
+		return err
+	}
+
+	current, err := r.newObject(gvk)
+	if err != nil {
+		return err
+	}
+
+	setOriginMetadata(ctx, desired)
+
+	drift := new(driftTracker)
+
+	exists := true
+	if err = r.Client.Get(ctx, client.ObjectKeyFromObject(desired), current); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		exists = false
+	}
+
+	if exists {
+		drift.trackSubset("labels", current.GetLabels(), desired.GetLabels())
+
+		if track != nil {
+			track(current, drift)
+		}
+	}
+
+	if err = r.apply(ctx, sa, desired); err != nil {
+		return err
+	}
+
+	if correction, ok := drift.correction(gvk.Kind, desired, exists); ok {
+		r.recordCorrection(ctx, sa, correction)
+	}
+
+	return nil
+}
+
+// update updates the object generated for the ServiceAccount, of which the fields specified have been changed, for
+// the changes server-side apply cannot perform, such as the removal of the fields not owned.
+// In the dry-run mode, the changes are reported instead of being written.
+func (r *ServiceAccountReconciler) update(ctx context.Context, sa *corev1.ServiceAccount, obj client.Object, fields ...string) error {
+	if r.isDryRun(ctx) {
+		gvk, err := apiutil.GVKForObject(obj, r.Client.Scheme())
+		if err != nil {
+			return err
+		}
+
+		if planWritten(ctx, gvk, obj) {
+			return nil
+		}
+
+		r.recordChange(ctx, sa, obj, Change{Action: ChangeUpdate, Kind: gvk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName(), Fields: fields})
+
+		return nil
+	}
+
+	return r.Client.Update(ctx, obj, client.FieldOwner(FieldManager))
+}
+
+// delete deletes the object generated for the ServiceAccount, if any, ignoring the objects already deleted.
+// In the dry-run mode, the deletion is reported instead of being performed.
+func (r *ServiceAccountReconciler) delete(ctx context.Context, sa *corev1.ServiceAccount, obj client.Object) error {
+	if r.isDryRun(ctx) {
+		gvk, err := apiutil.GVKForObject(obj, r.Client.Scheme())
+		if err != nil {
+			return err
+		}
+
+		planDeleted(ctx, gvk, obj)
+		r.recordChange(ctx, sa, obj, Change{Action: ChangeDelete, Kind: gvk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName()})
+
+		return nil
+	}
+
+	return client.IgnoreNotFound(r.Client.Delete(ctx, obj))
+}
+
+// newObject returns an empty object of the kind specified, unstructured if not registered in the scheme.
+func (r *ServiceAccountReconciler) newObject(gvk schema.GroupVersionKind) (client.Object, error) {
+	if !r.Client.Scheme().Recognizes(gvk) {
+		obj := new(unstructured.Unstructured)
+		obj.SetGroupVersionKind(gvk)
+
+		return obj, nil
+	}
+
+	obj, err := r.Client.Scheme().New(gvk)
+	if err != nil {
+		return nil, err
+	}
+
+	cObj, ok := obj.(client.Object)
+	if !ok {
+		return nil, apierrors.NewBadRequest("unexpected object kind " + gvk.Kind)
+	}
+
+	return cObj, nil
+}
+
+// recordConflict reports the conflict of the fields applied to the object with the other managers.
+func (r *ServiceAccountReconciler) recordConflict(ctx context.Context, sa *corev1.ServiceAccount, kind string, obj client.Object, err error) {
+	var causes []string
+
+	if status, ok := err.(apierrors.APIStatus); ok && status.Status().Details != nil { //nolint:errorlint
+		for _, cause := range status.Status().Details.Causes {
+			causes = append(causes, cause.Message)
+		}
+	}
+
+	message := kind + " " + client.ObjectKeyFromObject(obj).String() + ": forcing the ownership of the conflicting fields"
+	if len(causes) > 0 {
+		message += ": " + strings.Join(causes, "; ")
+	}
+
+	r.logger(ctx).Info("Conflict applying a generated object", "conflict", message)
+
+	metrics.ApplyConflicts.WithLabelValues(kind).Inc()
+
+	if r.recorder != nil {
+		r.recorder.Event(sa, corev1.EventTypeWarning, ApplyConflictReason, message)
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AuditRecord describes a credential object issued by the addon: a Secret, the Capsule resource distributing it, or
+// the impersonator RBAC, along with the ServiceAccount and the Tenant it has been generated for.
+type AuditRecord struct {
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace,omitempty"`
+	Name      string    `json:"name"`
+	Component string    `json:"component,omitempty"`
+	Created   time.Time `json:"created"`
+	// ServiceAccount is the ServiceAccount the object has been generated for, in the namespace/name form.
+	ServiceAccount string `json:"serviceAccount"`
+	Tenant         string `json:"tenant,omitempty"`
+	// TokenExpiration is the expiration of the token held by the Secret, nil when it does not expire.
+	TokenExpiration *time.Time `json:"tokenExpiration,omitempty"`
+	// DistributedTo are the Namespaces the kubeConfig Secret is copied to by the Capsule resource.
+	DistributedTo []string `json:"distributedTo,omitempty"`
+	// Orphan reports why the object is not served anymore by the addon, empty when it is.
+	Orphan string `json:"orphan,omitempty"`
+}
+
+// auditedObjects returns the kinds of the credential objects issued by the addon.
+func auditedObjects() []client.ObjectList {
+	return []client.ObjectList{
+		&corev1.SecretList{},
+		&capsulev1beta2.GlobalTenantResourceList{},
+		&capsulev1beta2.TenantResourceList{},
+		&rbacv1.ClusterRoleList{},
+		&rbacv1.ClusterRoleBindingList{},
+	}
+}
+
+// Audit returns the records of the credential objects issued by the addon, identified by its labels, correlated to
+// the ServiceAccounts and the Tenants they have been generated for, flagging the orphaned ones.
+func (r *ServiceAccountReconciler) Audit(ctx context.Context) ([]AuditRecord, error) {
+	var records []AuditRecord
+
+	for _, list := range auditedObjects() {
+		if err := r.Client.List(ctx, list, client.MatchingLabels{LabelManagedBy: ManagerName}); err != nil {
+			return nil, errors.Wrapf(err, "error listing %T", list)
+		}
+
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			obj, ok := item.(client.Object)
+			if !ok {
+				continue
+			}
+
+			record, recordErr := r.auditRecord(ctx, obj)
+			if recordErr != nil {
+				return nil, recordErr
+			}
+
+			records = append(records, record)
+		}
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].ServiceAccount != records[j].ServiceAccount {
+			return records[i].ServiceAccount < records[j].ServiceAccount
+		}
+
+		return records[i].Kind < records[j].Kind
+	})
+
+	return records, nil
+}
+
+func (r *ServiceAccountReconciler) auditRecord(ctx context.Context, obj client.Object) (AuditRecord, error) {
+	gvk, err := r.Client.GroupVersionKindFor(obj)
+	if err != nil {
+		return AuditRecord{}, err
+	}
+
+	labels := obj.GetLabels()
+
+	record := AuditRecord{
+		Kind:           gvk.Kind,
+		Namespace:      obj.GetNamespace(),
+		Name:           obj.GetName(),
+		Component:      labels[LabelComponent],
+		Created:        obj.GetCreationTimestamp().Time,
+		ServiceAccount: serviceAccountKey(labels[LabelServiceAccountNamespace], labels[LabelServiceAccountName]),
+		Tenant:         labels[LabelTenant],
+	}
+
+	if secret, ok := obj.(*corev1.Secret); ok {
+		record.TokenExpiration = secretTokenExpiration(secret)
+	}
+
+	if record.Orphan, err = r.orphanReason(ctx, labels); err != nil {
+		return record, err
+	}
+
+	// The Namespaces are the ones reported by the Capsule resources, rather than the ones of the Tenant.
+	switch obj := obj.(type) {
+	case *capsulev1beta2.GlobalTenantResource:
+		record.DistributedTo = processedNamespaces(obj.Status.ProcessedItems)
+	case *capsulev1beta2.TenantResource:
+		record.DistributedTo = processedNamespaces(obj.Status.ProcessedItems)
+	case *corev1.Secret:
+		// The copies replicated across the Tenant Namespaces are not distributed any further.
+		if record.Component == ComponentKubeconfig && obj.Namespace == labels[LabelServiceAccountNamespace] {
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+				Namespace: labels[LabelServiceAccountNamespace],
+				Name:      labels[LabelServiceAccountName],
+			}}
+
+			if record.DistributedTo, err = r.distributedNamespaces(ctx, sa); err != nil {
+				return record, errors.Wrap(err, "error listing the kubeConfig distributed namespaces")
+			}
+		}
+	}
+
+	if record.Tenant == "" {
+		return record, nil
+	}
+
+	if err = r.Client.Get(ctx, types.NamespacedName{Name: record.Tenant}, new(capsulev1beta2.Tenant)); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return record, errors.Wrap(err, "error getting the tenant")
+		}
+
+		if record.Orphan == "" {
+			record.Orphan = "Tenant not found"
+		}
+	}
+
+	return record, nil
+}
+
+// orphanReason returns why the ServiceAccount identified by the labels of a generated object is not served anymore,
+// empty when it is.
+func (r *ServiceAccountReconciler) orphanReason(ctx context.Context, labels map[string]string) (string, error) {
+	if labels[LabelServiceAccountName] == "" || labels[LabelServiceAccountNamespace] == "" {
+		return "ServiceAccount not identified", nil
+	}
+
+	sa := new(corev1.ServiceAccount)
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: labels[LabelServiceAccountNamespace], Name: labels[LabelServiceAccountName]}, sa); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "ServiceAccount not found", nil
+		}
+
+		return "", errors.Wrap(err, "error getting the service account")
+	}
+
+	managed, err := r.isCredentialManaged(ctx, sa)
+	if err != nil {
+		return "", errors.Wrap(err, "error listing FluxTenantCredentials for service account")
+	}
+
+	if !managed && !IsAddonEnabled(sa) {
+		return "ServiceAccount not enabled", nil
+	}
+
+	return "", nil
+}
+
+// secretTokenExpiration returns the expiration of the token held by the Secret, nil when it does not expire.
+func secretTokenExpiration(secret *corev1.Secret) *time.Time {
+	expiration, err := time.Parse(time.RFC3339, secret.GetAnnotations()[KubeconfigTokenExpirationAnnotationKey])
+	if err != nil {
+		return nil
+	}
+
+	return &expiration
+}
@@ -0,0 +1,95 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/indexer"
+)
+
+func TestAuditDistributedTo(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, capsulev1beta2.AddToScheme, v1alpha1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+		Namespace:   "oil-system",
+		Name:        "gitops-reconciler",
+		Annotations: map[string]string{ServiceAccountAddonAnnotationKey: ServiceAccountAddonAnnotationValue},
+	}}
+
+	processedSecret := func(namespace string) capsulev1beta2.ObjectReferenceStatus {
+		return capsulev1beta2.ObjectReferenceStatus{
+			ObjectReferenceAbstract: capsulev1beta2.ObjectReferenceAbstract{Kind: "Secret", Namespace: namespace, APIVersion: "v1"},
+			Name:                    "gitops-reconciler-kubeconfig",
+		}
+	}
+
+	// The Tenant reports more Namespaces than the ones the kubeConfig Secret has been replicated to so far.
+	tnt := &capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{Name: "oil"},
+		Status:     capsulev1beta2.TenantStatus{Namespaces: []string{"oil-dev", "oil-prod", "oil-system"}},
+	}
+
+	gtrLabels := rbacLabels(nil, sa)
+	gtrLabels[LabelTenant] = tnt.Name
+
+	gtr := &capsulev1beta2.GlobalTenantResource{
+		ObjectMeta: metav1.ObjectMeta{Name: "oil-gitops-reconciler-kubeconfig", Labels: gtrLabels},
+		Status: capsulev1beta2.GlobalTenantResourceStatus{
+			ProcessedItems: capsulev1beta2.ProcessedItems{processedSecret("oil-dev")},
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithIndex(&v1alpha1.FluxTenantCredential{}, indexer.FluxTenantCredentialServiceAccountField,
+			indexer.FluxTenantCredentialServiceAccount{}.Func()).
+		WithObjects(sa, tnt, gtr,
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: sa.Namespace, Name: "gitops-reconciler-kubeconfig", Labels: kubeconfigSecretLabels(sa)}},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "oil-dev", Name: "gitops-reconciler-kubeconfig", Labels: kubeconfigSecretLabels(sa)}},
+		).
+		WithStatusSubresource(gtr).
+		Build()
+
+	r := NewServiceAccountReconciler(WithClient(c), WithLogger(logr.Discard()))
+
+	records, err := r.Audit(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[client.ObjectKey][]string{
+		{Name: gtr.Name}: {"oil-dev"},
+		{Namespace: sa.Namespace, Name: "gitops-reconciler-kubeconfig"}: {"oil-dev"},
+		{Namespace: "oil-dev", Name: "gitops-reconciler-kubeconfig"}:    nil,
+	}
+
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, got %v", len(expected), records)
+	}
+
+	for _, record := range records {
+		key := client.ObjectKey{Namespace: record.Namespace, Name: record.Name}
+
+		if distributedTo := expected[key]; !slices.Equal(record.DistributedTo, distributedTo) {
+			t.Fatalf("expected %s %s distributed to %v, got %v", record.Kind, key, distributedTo, record.DistributedTo)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+var (
+	GitRepositoryGroupVersionKind = schema.GroupVersionKind{Group: "source.toolkit.fluxcd.io", Version: "v1", Kind: "GitRepository"}
+	OCIRepositoryGroupVersionKind = schema.GroupVersionKind{Group: "source.toolkit.fluxcd.io", Version: "v1beta2", Kind: "OCIRepository"}
+	BucketGroupVersionKind        = schema.GroupVersionKind{Group: "source.toolkit.fluxcd.io", Version: "v1beta2", Kind: "Bucket"}
+	KustomizationGroupVersionKind = schema.GroupVersionKind{Group: "kustomize.toolkit.fluxcd.io", Version: "v1", Kind: "Kustomization"}
+)
+
+// BootstrapSourceGroupVersionKinds are the Flux sources the Kustomization of the ServiceAccount can be bootstrapped
+// from.
+var BootstrapSourceGroupVersionKinds = []schema.GroupVersionKind{
+	GitRepositoryGroupVersionKind,
+	OCIRepositoryGroupVersionKind,
+	BucketGroupVersionKind,
+}
+
+// Bootstrap is the source the Flux source and Kustomization of the ServiceAccount are bootstrapped from.
+type Bootstrap struct {
+	// SourceKind is the kind of the Flux source, one of the BootstrapSourceGroupVersionKinds.
+	SourceKind string
+	// URL of the Git repository, or of the OCI artifact.
+	URL string
+	// Branch of the Git repository.
+	Branch string
+	// Tag of the OCI artifact.
+	Tag string
+	// Bucket is the bucket the manifests are fetched from.
+	Bucket BootstrapBucket
+	// Path of the Kustomization, relative to the source root.
+	Path string
+	// SecretName is the Secret, in the ServiceAccount Namespace, holding the source credentials, if any.
+	SecretName string
+	// Verify enables the verification of the Git commits or of the OCI artifacts signatures, when not nil.
+	Verify *BootstrapVerification
+	// Interval of the source and Kustomization reconciliations.
+	SourceInterval        time.Duration
+	KustomizationInterval time.Duration
+}
+
+// BootstrapBucket is the bucket of a Bucket source.
+type BootstrapBucket struct {
+	Name     string
+	Endpoint string
+	Provider string
+	Region   string
+}
+
+// BootstrapVerification are the verification settings of a source.
+type BootstrapVerification struct {
+	// Provider of the OCI artifacts signatures, cosign or notation.
+	Provider string
+	// Mode of the Git commits verification, HEAD, Tag or TagAndHEAD.
+	Mode string
+	// SecretName is the Secret, in the ServiceAccount Namespace, holding the trusted public keys, if any.
+	SecretName string
+	// MatchOIDCIdentity are the OIDC identities the keyless cosign signatures must match.
+	MatchOIDCIdentity []BootstrapOIDCIdentity
+}
+
+// BootstrapOIDCIdentity is an OIDC identity of keyless cosign signatures, as issuer and subject regular expressions.
+type BootstrapOIDCIdentity struct {
+	Issuer  string
+	Subject string
+}
+
+// DetectBootstrapSources returns the Flux sources installed, the bootstrap can be enabled for, if the Flux
+// Kustomization API is installed too.
+func DetectBootstrapSources(mapper meta.RESTMapper) []schema.GroupVersionKind {
+	if _, err := mapper.RESTMapping(KustomizationGroupVersionKind.GroupKind(), KustomizationGroupVersionKind.Version); err != nil {
+		return nil
+	}
+
+	var sources []schema.GroupVersionKind
+
+	for _, gvk := range BootstrapSourceGroupVersionKinds {
+		if _, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+			sources = append(sources, gvk)
+		}
+	}
+
+	return sources
+}
+
+// BootstrapEnabled returns true if the bootstrap of the Flux sources and Kustomization is enabled.
+func (r *ServiceAccountReconciler) BootstrapEnabled() bool {
+	return len(r.bootstrapSources) > 0
+}
+
+// BootstrapGroupVersionKinds returns the kinds of the objects bootstrapped, with the sources first.
+func (r *ServiceAccountReconciler) BootstrapGroupVersionKinds() []schema.GroupVersionKind {
+	if !r.BootstrapEnabled() {
+		return nil
+	}
+
+	return append(append([]schema.GroupVersionKind{}, r.bootstrapSources...), KustomizationGroupVersionKind)
+}
+
+// annotationBootstrap returns the Bootstrap of the ServiceAccount, as configured with its annotations, if any.
+func annotationBootstrap(sa *corev1.ServiceAccount) *Bootstrap {
+	annotations := sa.GetAnnotations()
+
+	kind := annotations[ServiceAccountBootstrapSourceKindAnnotationKey]
+	if kind == "" {
+		kind = GitRepositoryGroupVersionKind.Kind
+	}
+
+	url, bucketName := annotations[ServiceAccountBootstrapURLAnnotationKey], annotations[ServiceAccountBootstrapBucketNameAnnotationKey]
+	if url == "" && bucketName == "" {
+		return nil
+	}
+
+	bootstrap := NewBootstrap(kind)
+	bootstrap.URL = url
+	bootstrap.Bucket.Name = bucketName
+
+	setIfNotEmpty(&bootstrap.Branch, annotations[ServiceAccountBootstrapBranchAnnotationKey])
+	setIfNotEmpty(&bootstrap.Tag, annotations[ServiceAccountBootstrapTagAnnotationKey])
+	setIfNotEmpty(&bootstrap.Path, annotations[ServiceAccountBootstrapPathAnnotationKey])
+	setIfNotEmpty(&bootstrap.Bucket.Endpoint, annotations[ServiceAccountBootstrapBucketEndpointAnnotationKey])
+	setIfNotEmpty(&bootstrap.Bucket.Provider, annotations[ServiceAccountBootstrapBucketProviderAnnotationKey])
+	setIfNotEmpty(&bootstrap.Bucket.Region, annotations[ServiceAccountBootstrapBucketRegionAnnotationKey])
+
+	bootstrap.SecretName = annotations[ServiceAccountBootstrapSecretAnnotationKey]
+
+	if provider := annotations[ServiceAccountBootstrapVerifyAnnotationKey]; provider != "" {
+		bootstrap.Verify = &BootstrapVerification{
+			SecretName: annotations[ServiceAccountBootstrapVerifySecretAnnotationKey],
+		}
+
+		if kind == OCIRepositoryGroupVersionKind.Kind {
+			bootstrap.Verify.Provider = provider
+		} else {
+			bootstrap.Verify.Mode = provider
+		}
+	}
+
+	return bootstrap
+}
+
+// NewBootstrap returns the Bootstrap from the source kind specified, with the default settings.
+func NewBootstrap(sourceKind string) *Bootstrap {
+	return &Bootstrap{
+		SourceKind: sourceKind,
+		Branch:     DefaultBootstrapBranch,
+		Tag:        DefaultBootstrapTag,
+		Path:       DefaultBootstrapPath,
+		Bucket: BootstrapBucket{
+			Provider: DefaultBootstrapBucketProvider,
+		},
+		SourceInterval:        DefaultBootstrapSourceInterval,
+		KustomizationInterval: DefaultBootstrapKustomizationInterval,
+	}
+}
+
+// ensureBootstrap ensures the Flux source and Kustomization of the ServiceAccount, named after it.
+// The Kustomization applies the manifests through the Capsule Proxy with the kubeConfig Secret, rather than
+// impersonating a ServiceAccount. The sources of other kinds previously bootstrapped are deleted.
+func (r *ServiceAccountReconciler) ensureBootstrap(ctx context.Context, sa *corev1.ServiceAccount, settings Settings) error {
+	sourceGVK, ok := r.bootstrapSource(settings.Bootstrap.SourceKind)
+	if !ok {
+		return errors.Errorf("the Flux %s and Kustomization APIs are not installed", settings.Bootstrap.SourceKind)
+	}
+
+	spec, err := bootstrapSourceSpec(settings.Bootstrap)
+	if err != nil {
+		return err
+	}
+
+	// The fields not applied anymore, such as the secretRef, are removed by the server-side apply.
+	source := serviceAccountObject(sourceGVK, sa)
+	source.SetLabels(bootstrapLabels(nil, sa))
+
+	if err = mergeSpec(source, spec); err != nil {
+		return err
+	}
+
+	if err = r.ensureUnstructured(ctx, sa, source); err != nil {
+		return errors.Wrapf(err, "error ensuring the bootstrap %s", strings.ToLower(sourceGVK.Kind))
+	}
+
+	kustomization, err := bootstrapKustomization(sa, settings, sourceGVK)
+	if err != nil {
+		return err
+	}
+
+	if err = r.ensureUnstructured(ctx, sa, kustomization); err != nil {
+		return errors.Wrap(err, "error ensuring the bootstrap kustomization")
+	}
+
+	for _, gvk := range r.bootstrapSources {
+		if gvk == sourceGVK {
+			continue
+		}
+
+		if err := r.deleteBootstrapObject(ctx, gvk, sa.Name, sa.Namespace); err != nil {
+			return errors.Wrapf(err, "error deleting the stale bootstrap %s", strings.ToLower(gvk.Kind))
+		}
+	}
+
+	return nil
+}
+
+// bootstrapKustomization returns the Kustomization of the ServiceAccount, applying the manifests of the bootstrap
+// source of the kind specified, named after the ServiceAccount too.
+func bootstrapKustomization(sa *corev1.ServiceAccount, settings Settings, sourceGVK schema.GroupVersionKind) (*unstructured.Unstructured, error) {
+	kustomization := serviceAccountObject(KustomizationGroupVersionKind, sa)
+	kustomization.SetLabels(bootstrapLabels(nil, sa))
+
+	if err := mergeSpec(kustomization, map[string]interface{}{
+		"interval": settings.Bootstrap.KustomizationInterval.String(),
+		"path":     settings.Bootstrap.Path,
+		"prune":    true,
+		"sourceRef": map[string]interface{}{
+			"kind": sourceGVK.Kind,
+			"name": sa.Name,
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := setKustomizationIdentity(kustomization, sa, settings); err != nil {
+		return nil, err
+	}
+
+	return kustomization, nil
+}
+
+// setKustomizationIdentity sets the identity the Kustomization applies the manifests as: the kubeConfig Secret through
+// the Capsule Proxy, or the impersonation of the ServiceAccount in the impersonation mode.
+func setKustomizationIdentity(kustomization *unstructured.Unstructured, sa *corev1.ServiceAccount, settings Settings) error {
+	if settings.Mode == ModeImpersonation {
+		return unstructured.SetNestedField(kustomization.Object, sa.Name, "spec", "serviceAccountName")
+	}
+
+	return unstructured.SetNestedMap(kustomization.Object, map[string]interface{}{
+		"secretRef": map[string]interface{}{
+			"name": settings.SecretName,
+			"key":  settings.SecretKey,
+		},
+	}, "spec", "kubeConfig")
+}
+
+// bootstrapSourceSpec returns the fields of the Flux source spec owned by the addon.
+func bootstrapSourceSpec(bootstrap *Bootstrap) (map[string]interface{}, error) {
+	spec := map[string]interface{}{
+		"interval": bootstrap.SourceInterval.String(),
+	}
+
+	switch bootstrap.SourceKind {
+	case GitRepositoryGroupVersionKind.Kind:
+		spec["url"] = bootstrap.URL
+		spec["ref"] = map[string]interface{}{"branch": bootstrap.Branch}
+
+		if bootstrap.Verify != nil {
+			if bootstrap.Verify.SecretName == "" {
+				return nil, errors.New("the verification of Git commits requires a Secret with the trusted public keys")
+			}
+
+			spec["verify"] = map[string]interface{}{
+				"mode":      bootstrap.Verify.Mode,
+				"secretRef": map[string]interface{}{"name": bootstrap.Verify.SecretName},
+			}
+		}
+	case OCIRepositoryGroupVersionKind.Kind:
+		spec["url"] = bootstrap.URL
+		spec["ref"] = map[string]interface{}{"tag": bootstrap.Tag}
+
+		if bootstrap.Verify != nil {
+			verify := map[string]interface{}{"provider": bootstrap.Verify.Provider}
+
+			if bootstrap.Verify.SecretName != "" {
+				verify["secretRef"] = map[string]interface{}{"name": bootstrap.Verify.SecretName}
+			}
+
+			if len(bootstrap.Verify.MatchOIDCIdentity) > 0 {
+				identities := make([]interface{}, 0, len(bootstrap.Verify.MatchOIDCIdentity))
+				for _, identity := range bootstrap.Verify.MatchOIDCIdentity {
+					identities = append(identities, map[string]interface{}{"issuer": identity.Issuer, "subject": identity.Subject})
+				}
+
+				verify["matchOIDCIdentity"] = identities
+			}
+
+			spec["verify"] = verify
+		}
+	case BucketGroupVersionKind.Kind:
+		if bootstrap.Verify != nil {
+			return nil, errors.New("the verification is not supported by Bucket sources")
+		}
+
+		spec["bucketName"] = bootstrap.Bucket.Name
+		spec["endpoint"] = bootstrap.Bucket.Endpoint
+		spec["provider"] = bootstrap.Bucket.Provider
+
+		if bootstrap.Bucket.Region != "" {
+			spec["region"] = bootstrap.Bucket.Region
+		}
+	default:
+		return nil, errors.Errorf("unsupported bootstrap source kind %s", bootstrap.SourceKind)
+	}
+
+	if bootstrap.SecretName != "" {
+		spec["secretRef"] = map[string]interface{}{"name": bootstrap.SecretName}
+	}
+
+	return spec, nil
+}
+
+// bootstrapSource returns the installed Flux source of the kind specified.
+func (r *ServiceAccountReconciler) bootstrapSource(kind string) (schema.GroupVersionKind, bool) {
+	for _, gvk := range r.bootstrapSources {
+		if gvk.Kind == kind {
+			return gvk, true
+		}
+	}
+
+	return schema.GroupVersionKind{}, false
+}
+
+// deleteBootstrap deletes, if present and managed by the addon, the Flux sources and Kustomization bootstrapped for
+// the ServiceAccount of which the name and the namespace are specified as arguments.
+func (r *ServiceAccountReconciler) deleteBootstrap(ctx context.Context, saName, saNamespace string) error {
+	gvks := r.BootstrapGroupVersionKinds()
+
+	for i := len(gvks) - 1; i >= 0; i-- {
+		if err := r.deleteBootstrapObject(ctx, gvks[i], saName, saNamespace); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteBootstrapObject deletes, if present and managed by the addon, the bootstrap object of the kind specified.
+func (r *ServiceAccountReconciler) deleteBootstrapObject(ctx context.Context, gvk schema.GroupVersionKind, saName, saNamespace string) error {
+	obj := new(unstructured.Unstructured)
+	obj.SetGroupVersionKind(gvk)
+
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: saNamespace, Name: saName}, obj); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if obj.GetLabels()[LabelManagedBy] != ManagerName || obj.GetLabels()[LabelComponent] != ComponentBootstrap {
+		return nil
+	}
+
+	return r.delete(ctx, nil, obj)
+}
+
+// ensureUnstructured applies the Flux object generated for the ServiceAccount, and controlled by it, recording the
+// correction of the spec fields drifted.
+func (r *ServiceAccountReconciler) ensureUnstructured(ctx context.Context, sa *corev1.ServiceAccount, obj *unstructured.Unstructured) error {
+	if err := controllerutil.SetControllerReference(sa, obj, r.Client.Scheme()); err != nil {
+		return err
+	}
+
+	spec := obj.Object["spec"]
+
+	return r.ensure(ctx, sa, obj, func(current client.Object, drift *driftTracker) {
+		if current, ok := current.(*unstructured.Unstructured); ok {
+			drift.trackSubset("spec", current.Object["spec"], spec)
+		}
+	})
+}
+
+// serviceAccountObject returns the object of the kind specified, named after the ServiceAccount.
+func serviceAccountObject(gvk schema.GroupVersionKind, sa *corev1.ServiceAccount) *unstructured.Unstructured {
+	obj := new(unstructured.Unstructured)
+	obj.SetGroupVersionKind(gvk)
+	obj.SetNamespace(sa.Namespace)
+	obj.SetName(sa.Name)
+
+	return obj
+}
+
+// bootstrapLabels returns the labels of the bootstrap objects, on top of the existing ones.
+func bootstrapLabels(labels map[string]string, sa *corev1.ServiceAccount) map[string]string {
+	out := rbacLabels(labels, sa)
+	out[LabelComponent] = ComponentBootstrap
+
+	return out
+}
+
+// mergeSpec sets the fields specified in the spec of the object, leaving the other ones untouched.
+func mergeSpec(obj *unstructured.Unstructured, fields map[string]interface{}) error {
+	for key, value := range fields {
+		if err := unstructured.SetNestedField(obj.Object, value, "spec", key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setIfNotEmpty sets the value to the target, unless empty.
+func setIfNotEmpty(target *string, value string) {
+	if value != "" {
+		*target = value
+	}
+}
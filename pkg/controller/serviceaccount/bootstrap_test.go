@@ -0,0 +1,336 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAnnotationBootstrap(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		bootstrap   *Bootstrap
+	}{
+		{
+			name: "not bootstrapped",
+			annotations: map[string]string{
+				ServiceAccountBootstrapBranchAnnotationKey: "develop",
+			},
+		},
+		{
+			name: "git repository defaults",
+			annotations: map[string]string{
+				ServiceAccountBootstrapURLAnnotationKey: "https://github.com/oil/gitops",
+			},
+			bootstrap: &Bootstrap{
+				SourceKind:            GitRepositoryGroupVersionKind.Kind,
+				URL:                   "https://github.com/oil/gitops",
+				Branch:                DefaultBootstrapBranch,
+				Tag:                   DefaultBootstrapTag,
+				Path:                  DefaultBootstrapPath,
+				Bucket:                BootstrapBucket{Provider: DefaultBootstrapBucketProvider},
+				SourceInterval:        DefaultBootstrapSourceInterval,
+				KustomizationInterval: DefaultBootstrapKustomizationInterval,
+			},
+		},
+		{
+			name: "git repository",
+			annotations: map[string]string{
+				ServiceAccountBootstrapSourceKindAnnotationKey: GitRepositoryGroupVersionKind.Kind,
+				ServiceAccountBootstrapURLAnnotationKey:        "ssh://git@github.com/oil/gitops",
+				ServiceAccountBootstrapBranchAnnotationKey:     "develop",
+				ServiceAccountBootstrapPathAnnotationKey:       "./tenants/oil",
+				ServiceAccountBootstrapSecretAnnotationKey:     "gitops-credentials",
+			},
+			bootstrap: &Bootstrap{
+				SourceKind:            GitRepositoryGroupVersionKind.Kind,
+				URL:                   "ssh://git@github.com/oil/gitops",
+				Branch:                "develop",
+				Tag:                   DefaultBootstrapTag,
+				Path:                  "./tenants/oil",
+				Bucket:                BootstrapBucket{Provider: DefaultBootstrapBucketProvider},
+				SecretName:            "gitops-credentials",
+				SourceInterval:        DefaultBootstrapSourceInterval,
+				KustomizationInterval: DefaultBootstrapKustomizationInterval,
+			},
+		},
+		{
+			name: "verified git repository",
+			annotations: map[string]string{
+				ServiceAccountBootstrapURLAnnotationKey:          "https://github.com/oil/gitops",
+				ServiceAccountBootstrapVerifyAnnotationKey:       "HEAD",
+				ServiceAccountBootstrapVerifySecretAnnotationKey: "gitops-keys",
+			},
+			bootstrap: &Bootstrap{
+				SourceKind:            GitRepositoryGroupVersionKind.Kind,
+				URL:                   "https://github.com/oil/gitops",
+				Branch:                DefaultBootstrapBranch,
+				Tag:                   DefaultBootstrapTag,
+				Path:                  DefaultBootstrapPath,
+				Bucket:                BootstrapBucket{Provider: DefaultBootstrapBucketProvider},
+				Verify:                &BootstrapVerification{Mode: "HEAD", SecretName: "gitops-keys"},
+				SourceInterval:        DefaultBootstrapSourceInterval,
+				KustomizationInterval: DefaultBootstrapKustomizationInterval,
+			},
+		},
+		{
+			name: "verified oci repository",
+			annotations: map[string]string{
+				ServiceAccountBootstrapSourceKindAnnotationKey: OCIRepositoryGroupVersionKind.Kind,
+				ServiceAccountBootstrapURLAnnotationKey:        "oci://ghcr.io/oil/manifests",
+				ServiceAccountBootstrapTagAnnotationKey:        "v1.0.0",
+				ServiceAccountBootstrapVerifyAnnotationKey:     "cosign",
+			},
+			bootstrap: &Bootstrap{
+				SourceKind:            OCIRepositoryGroupVersionKind.Kind,
+				URL:                   "oci://ghcr.io/oil/manifests",
+				Branch:                DefaultBootstrapBranch,
+				Tag:                   "v1.0.0",
+				Path:                  DefaultBootstrapPath,
+				Bucket:                BootstrapBucket{Provider: DefaultBootstrapBucketProvider},
+				Verify:                &BootstrapVerification{Provider: "cosign"},
+				SourceInterval:        DefaultBootstrapSourceInterval,
+				KustomizationInterval: DefaultBootstrapKustomizationInterval,
+			},
+		},
+		{
+			name: "bucket",
+			annotations: map[string]string{
+				ServiceAccountBootstrapSourceKindAnnotationKey:     BucketGroupVersionKind.Kind,
+				ServiceAccountBootstrapBucketNameAnnotationKey:     "oil-manifests",
+				ServiceAccountBootstrapBucketEndpointAnnotationKey: "s3.amazonaws.com",
+				ServiceAccountBootstrapBucketProviderAnnotationKey: "aws",
+				ServiceAccountBootstrapBucketRegionAnnotationKey:   "eu-west-1",
+			},
+			bootstrap: &Bootstrap{
+				SourceKind:            BucketGroupVersionKind.Kind,
+				Branch:                DefaultBootstrapBranch,
+				Tag:                   DefaultBootstrapTag,
+				Path:                  DefaultBootstrapPath,
+				Bucket:                BootstrapBucket{Name: "oil-manifests", Endpoint: "s3.amazonaws.com", Provider: "aws", Region: "eu-west-1"},
+				SourceInterval:        DefaultBootstrapSourceInterval,
+				KustomizationInterval: DefaultBootstrapKustomizationInterval,
+			},
+		},
+		{
+			name: "unsupported source kind",
+			annotations: map[string]string{
+				ServiceAccountBootstrapSourceKindAnnotationKey: "HelmRepository",
+				ServiceAccountBootstrapURLAnnotationKey:        "https://charts.example.com",
+			},
+			bootstrap: &Bootstrap{
+				SourceKind:            "HelmRepository",
+				URL:                   "https://charts.example.com",
+				Branch:                DefaultBootstrapBranch,
+				Tag:                   DefaultBootstrapTag,
+				Path:                  DefaultBootstrapPath,
+				Bucket:                BootstrapBucket{Provider: DefaultBootstrapBucketProvider},
+				SourceInterval:        DefaultBootstrapSourceInterval,
+				KustomizationInterval: DefaultBootstrapKustomizationInterval,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "oil-system", Name: "gitops-reconciler", Annotations: tt.annotations}}
+
+			if bootstrap := annotationBootstrap(sa); !equality.Semantic.DeepEqual(bootstrap, tt.bootstrap) {
+				t.Fatalf("expected the bootstrap %+v, got %+v", tt.bootstrap, bootstrap)
+			}
+		})
+	}
+}
+
+func TestBootstrapSourceSpec(t *testing.T) {
+	tests := []struct {
+		name      string
+		bootstrap *Bootstrap
+		spec      map[string]interface{}
+		err       bool
+	}{
+		{
+			name: "git repository",
+			bootstrap: &Bootstrap{
+				SourceKind:     GitRepositoryGroupVersionKind.Kind,
+				URL:            "https://github.com/oil/gitops",
+				Branch:         "main",
+				SecretName:     "gitops-credentials",
+				SourceInterval: time.Minute,
+			},
+			spec: map[string]interface{}{
+				"interval":  "1m0s",
+				"url":       "https://github.com/oil/gitops",
+				"ref":       map[string]interface{}{"branch": "main"},
+				"secretRef": map[string]interface{}{"name": "gitops-credentials"},
+			},
+		},
+		{
+			name: "verified git repository",
+			bootstrap: &Bootstrap{
+				SourceKind:     GitRepositoryGroupVersionKind.Kind,
+				URL:            "https://github.com/oil/gitops",
+				Branch:         "main",
+				Verify:         &BootstrapVerification{Mode: "HEAD", SecretName: "gitops-keys"},
+				SourceInterval: time.Minute,
+			},
+			spec: map[string]interface{}{
+				"interval": "1m0s",
+				"url":      "https://github.com/oil/gitops",
+				"ref":      map[string]interface{}{"branch": "main"},
+				"verify": map[string]interface{}{
+					"mode":      "HEAD",
+					"secretRef": map[string]interface{}{"name": "gitops-keys"},
+				},
+			},
+		},
+		{
+			name: "git repository verified without keys",
+			bootstrap: &Bootstrap{
+				SourceKind: GitRepositoryGroupVersionKind.Kind,
+				URL:        "https://github.com/oil/gitops",
+				Verify:     &BootstrapVerification{Mode: "HEAD"},
+			},
+			err: true,
+		},
+		{
+			name: "keyless verified oci repository",
+			bootstrap: &Bootstrap{
+				SourceKind: OCIRepositoryGroupVersionKind.Kind,
+				URL:        "oci://ghcr.io/oil/manifests",
+				Tag:        "latest",
+				Verify: &BootstrapVerification{
+					Provider:          "cosign",
+					MatchOIDCIdentity: []BootstrapOIDCIdentity{{Issuer: "^https://token.actions.githubusercontent.com$", Subject: "^https://github.com/oil/.*$"}},
+				},
+				SourceInterval: time.Minute,
+			},
+			spec: map[string]interface{}{
+				"interval": "1m0s",
+				"url":      "oci://ghcr.io/oil/manifests",
+				"ref":      map[string]interface{}{"tag": "latest"},
+				"verify": map[string]interface{}{
+					"provider": "cosign",
+					"matchOIDCIdentity": []interface{}{
+						map[string]interface{}{"issuer": "^https://token.actions.githubusercontent.com$", "subject": "^https://github.com/oil/.*$"},
+					},
+				},
+			},
+		},
+		{
+			name: "bucket",
+			bootstrap: &Bootstrap{
+				SourceKind:     BucketGroupVersionKind.Kind,
+				Bucket:         BootstrapBucket{Name: "oil-manifests", Endpoint: "minio.example.com", Provider: "generic"},
+				SecretName:     "minio-credentials",
+				SourceInterval: time.Minute,
+			},
+			spec: map[string]interface{}{
+				"interval":   "1m0s",
+				"bucketName": "oil-manifests",
+				"endpoint":   "minio.example.com",
+				"provider":   "generic",
+				"secretRef":  map[string]interface{}{"name": "minio-credentials"},
+			},
+		},
+		{
+			name: "verified bucket",
+			bootstrap: &Bootstrap{
+				SourceKind: BucketGroupVersionKind.Kind,
+				Bucket:     BootstrapBucket{Name: "oil-manifests", Endpoint: "minio.example.com"},
+				Verify:     &BootstrapVerification{Provider: "cosign"},
+			},
+			err: true,
+		},
+		{
+			name:      "unsupported source kind",
+			bootstrap: &Bootstrap{SourceKind: "HelmRepository", URL: "https://charts.example.com"},
+			err:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := bootstrapSourceSpec(tt.bootstrap)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("expected an error, got the spec %v", spec)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !equality.Semantic.DeepEqual(spec, tt.spec) {
+				t.Fatalf("expected the spec %v, got %v", tt.spec, spec)
+			}
+		})
+	}
+}
+
+func TestBootstrapKustomization(t *testing.T) {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "oil-system", Name: "gitops-reconciler"}}
+	bootstrap := &Bootstrap{Path: "./tenants/oil", KustomizationInterval: 10 * time.Minute}
+
+	tests := []struct {
+		name     string
+		settings Settings
+		identity map[string]interface{}
+	}{
+		{
+			name:     "kubeconfig",
+			settings: Settings{Mode: ModeKubeconfig, SecretName: "gitops-reconciler-kubeconfig", SecretKey: "kubeconfig", Bootstrap: bootstrap},
+			identity: map[string]interface{}{
+				"kubeConfig": map[string]interface{}{
+					"secretRef": map[string]interface{}{"name": "gitops-reconciler-kubeconfig", "key": "kubeconfig"},
+				},
+			},
+		},
+		{
+			name:     "impersonation",
+			settings: Settings{Mode: ModeImpersonation, Bootstrap: bootstrap},
+			identity: map[string]interface{}{"serviceAccountName": "gitops-reconciler"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kustomization, err := bootstrapKustomization(sa, tt.settings, GitRepositoryGroupVersionKind)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			spec := map[string]interface{}{
+				"interval":  "10m0s",
+				"path":      "./tenants/oil",
+				"prune":     true,
+				"sourceRef": map[string]interface{}{"kind": "GitRepository", "name": "gitops-reconciler"},
+			}
+			for key, value := range tt.identity {
+				spec[key] = value
+			}
+
+			if !equality.Semantic.DeepEqual(kustomization.Object["spec"], spec) {
+				t.Fatalf("expected the spec %v, got %v", spec, kustomization.Object["spec"])
+			}
+
+			if kustomization.GetNamespace() != sa.Namespace || kustomization.GetName() != sa.Name {
+				t.Fatalf("expected the Kustomization %s/%s, got %s/%s", sa.Namespace, sa.Name, kustomization.GetNamespace(), kustomization.GetName())
+			}
+
+			if kustomization.GetLabels()[LabelComponent] != ComponentBootstrap {
+				t.Fatalf("expected the %s component label, got %v", ComponentBootstrap, kustomization.GetLabels())
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+)
+
+// DefaultTokenExpiration is the lifetime of the tokens issued with the TokenRequest API, when not specified.
+const DefaultTokenExpiration = 24 * time.Hour
+
+// activeConfiguration returns the AddonConfiguration in use: the one selected at reconciler-level, with its last
+// validated specification. While the current specification is not validated, the last validated one is used, and
+// the ErrConfigurationNotValidated error is returned when there is none, so that nothing is applied meanwhile.
+// An empty configuration is returned only when no configuration is selected, or it has not been found since the
+// reconciler started, leaving the reconciler-level defaults: once deleted, the last validated one is still in use.
+func (r *ServiceAccountReconciler) activeConfiguration(ctx context.Context) (*v1alpha1.AddonConfiguration, error) {
+	cfg := new(v1alpha1.AddonConfiguration)
+
+	if r.configurationName == "" {
+		return cfg, nil
+	}
+
+	last := r.validatedConfiguration.Load()
+
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: r.configurationName}, cfg); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+
+		cfg = &v1alpha1.AddonConfiguration{ObjectMeta: metav1.ObjectMeta{Name: r.configurationName}}
+
+		if last != nil {
+			r.logger(ctx).Info("AddonConfiguration not found, using its last validated specification", "configuration", cfg.Name)
+
+			cfg.Spec = *last.DeepCopy()
+		}
+
+		return cfg, nil
+	}
+
+	var spec *v1alpha1.AddonConfigurationSpec
+
+	switch {
+	case IsConfigurationValid(cfg):
+		spec = &cfg.Spec
+	case cfg.Status.ValidatedSpec != nil:
+		r.logger(ctx).Info("AddonConfiguration is not validated, using its last validated specification", "configuration", cfg.Name)
+
+		spec = cfg.Status.ValidatedSpec
+	case last != nil:
+		r.logger(ctx).Info("AddonConfiguration is not validated, using its last validated specification", "configuration", cfg.Name)
+
+		spec = last
+	default:
+		return nil, errors.Wrapf(ErrConfigurationNotValidated, "AddonConfiguration %s", cfg.Name)
+	}
+
+	r.validatedConfiguration.Store(spec.DeepCopy())
+
+	cfg.Spec = *spec.DeepCopy()
+
+	return cfg, nil
+}
+
+// IsConfigurationValid returns true if the current generation of the AddonConfiguration has been validated.
+func IsConfigurationValid(cfg *v1alpha1.AddonConfiguration) bool {
+	condition := meta.FindStatusCondition(cfg.Status.Conditions, v1alpha1.ReadyCondition)
+
+	return condition != nil && condition.Status == metav1.ConditionTrue && condition.ObservedGeneration == cfg.Generation
+}
+
+// SecretName returns the name of the kubeConfig Secret of the ServiceAccount, rendered from the template specified.
+func SecretName(template, saName string) string {
+	return strings.ReplaceAll(template, SecretNamePatternName, saName)
+}
+
+// applyDefaults sets the defaults specified by an AddonConfiguration to the credential Settings of the ServiceAccount.
+func applyDefaults(settings *Settings, sa *corev1.ServiceAccount, defaults v1alpha1.AddonDefaults) {
+	setIfNotEmpty(&settings.Mode, string(defaults.Mode))
+
+	if defaults.Proxy != nil && defaults.Proxy.URL != "" {
+		settings.ProxyURL = defaults.Proxy.URL
+	}
+
+	if defaults.RBAC != nil && defaults.RBAC.ClusterRoleName != "" {
+		settings.ClusterRoleName = defaults.RBAC.ClusterRoleName
+	}
+
+	if defaults.Impersonator != nil && len(defaults.Impersonator.Resources) > 0 {
+		settings.ImpersonatorResources = make([]string, 0, len(defaults.Impersonator.Resources))
+
+		for _, resource := range defaults.Impersonator.Resources {
+			settings.ImpersonatorResources = append(settings.ImpersonatorResources, string(resource))
+		}
+	}
+
+	if defaults.Secret != nil {
+		if defaults.Secret.NameTemplate != "" {
+			settings.SecretName = SecretName(defaults.Secret.NameTemplate, sa.Name)
+		}
+
+		if defaults.Secret.Key != "" {
+			settings.SecretKey = defaults.Secret.Key
+		}
+	}
+
+	if defaults.Notification != nil {
+		setIfNotEmpty(&settings.NotificationTemplate.ProviderType, defaults.Notification.ProviderType)
+		setIfNotEmpty(&settings.NotificationTemplate.EventSeverity, defaults.Notification.EventSeverity)
+		setIfNotEmpty(&settings.NotificationTemplate.AddressAnnotation, defaults.Notification.AddressAnnotation)
+	}
+
+	if defaults.TokenPolicy != nil {
+		settings.TokenExpiration = TokenExpiration(settings.TokenExpiration, *defaults.TokenPolicy)
+	}
+}
+
+// TokenExpiration returns the lifetime of the tokens issued according to the TokenPolicy, zero when the token of a
+// ServiceAccount token Secret is used. The type, and the lifetime, not set by the TokenPolicy are inherited from the
+// lifetime specified.
+func TokenExpiration(inherited time.Duration, policy v1alpha1.TokenPolicySpec) time.Duration {
+	tokenRequest := policy.Type == v1alpha1.TokenRequestType || (policy.Type == "" && inherited > 0)
+
+	switch {
+	case !tokenRequest:
+		return 0
+	case policy.ExpirationSeconds != nil:
+		return time.Duration(*policy.ExpirationSeconds) * time.Second
+	case inherited > 0:
+		return inherited
+	default:
+		return DefaultTokenExpiration
+	}
+}
+
+// namespaceTenant returns the Tenant controlling the Namespace of the ServiceAccount, if any.
+func (r *ServiceAccountReconciler) namespaceTenant(ctx context.Context, sa *corev1.ServiceAccount) (*capsulev1beta2.Tenant, bool, error) {
+	ns := new(corev1.Namespace)
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: sa.Namespace}, ns); err != nil {
+		return nil, false, err
+	}
+
+	owner := metav1.GetControllerOf(ns)
+	if owner == nil || owner.Kind != "Tenant" {
+		return nil, false, nil
+	}
+
+	tnt := new(capsulev1beta2.Tenant)
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: owner.Name}, tnt); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, false, nil
+		}
+
+		return nil, false, err
+	}
+
+	return tnt, true, nil
+}
+
+// tenantOverride returns the first override of the AddonConfiguration matching the Tenant, if any.
+func tenantOverride(cfg *v1alpha1.AddonConfiguration, tnt *capsulev1beta2.Tenant) (*v1alpha1.TenantOverride, bool) {
+	for i, override := range cfg.Spec.Overrides {
+		selector, err := metav1.LabelSelectorAsSelector(&override.TenantSelector)
+		if err != nil {
+			continue
+		}
+
+		if selector.Matches(labels.Set(tnt.GetLabels())) {
+			return &cfg.Spec.Overrides[i], true
+		}
+	}
+
+	return nil, false
+}
+
+// allowedTenants returns the Tenants allowed by the AddonConfiguration: all of them when not restricted.
+func allowedTenants(cfg *v1alpha1.AllowedTenantsSpec, tenants []capsulev1beta2.Tenant) []capsulev1beta2.Tenant {
+	if cfg == nil || (len(cfg.Names) == 0 && cfg.Selector == nil) {
+		return tenants
+	}
+
+	names := sets.New[string](cfg.Names...)
+
+	selector := labels.Nothing()
+
+	if cfg.Selector != nil {
+		if s, err := metav1.LabelSelectorAsSelector(cfg.Selector); err == nil {
+			selector = s
+		}
+	}
+
+	var out []capsulev1beta2.Tenant
+
+	for _, tnt := range tenants {
+		if names.Has(tnt.Name) || selector.Matches(labels.Set(tnt.GetLabels())) {
+			out = append(out, tnt)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,163 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+)
+
+// newConfiguration returns an AddonConfiguration of the generation specified, with the proxy URL and the last
+// validated specification specified, and the Ready condition observed at the generation specified, if any.
+func newConfiguration(generation int64, url string, readyGeneration int64, validated *v1alpha1.AddonConfigurationSpec) *v1alpha1.AddonConfiguration {
+	cfg := &v1alpha1.AddonConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Generation: generation},
+		Spec: v1alpha1.AddonConfigurationSpec{
+			AddonDefaults: v1alpha1.AddonDefaults{Proxy: &v1alpha1.ProxySpec{URL: url}},
+		},
+		Status: v1alpha1.AddonConfigurationStatus{ValidatedSpec: validated},
+	}
+
+	if readyGeneration > 0 {
+		cfg.Status.Conditions = []metav1.Condition{{
+			Type:               v1alpha1.ReadyCondition,
+			Status:             metav1.ConditionTrue,
+			Reason:             v1alpha1.ActiveReason,
+			ObservedGeneration: readyGeneration,
+		}}
+	}
+
+	return cfg
+}
+
+func TestIsConfigurationValid(t *testing.T) {
+	invalid := newConfiguration(1, "", 0, nil)
+	invalid.Status.Conditions = []metav1.Condition{{
+		Type:               v1alpha1.ReadyCondition,
+		Status:             metav1.ConditionFalse,
+		Reason:             v1alpha1.InvalidReason,
+		ObservedGeneration: 1,
+	}}
+
+	tests := []struct {
+		name  string
+		cfg   *v1alpha1.AddonConfiguration
+		valid bool
+	}{
+		{name: "not validated", cfg: newConfiguration(1, "", 0, nil)},
+		{name: "validated", cfg: newConfiguration(2, "", 2, nil), valid: true},
+		{name: "previous generation validated", cfg: newConfiguration(2, "", 1, nil)},
+		{name: "invalid", cfg: invalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if valid := IsConfigurationValid(tt.cfg); valid != tt.valid {
+				t.Fatalf("expected the configuration validity to be %t, got %t", tt.valid, valid)
+			}
+		})
+	}
+}
+
+func TestActiveConfiguration(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	validated := &v1alpha1.AddonConfigurationSpec{
+		AddonDefaults: v1alpha1.AddonDefaults{Proxy: &v1alpha1.ProxySpec{URL: "https://validated:9001"}},
+	}
+	cached := &v1alpha1.AddonConfigurationSpec{
+		AddonDefaults: v1alpha1.AddonDefaults{Proxy: &v1alpha1.ProxySpec{URL: "https://cached:9001"}},
+	}
+
+	tests := []struct {
+		name   string
+		cfg    *v1alpha1.AddonConfiguration
+		cached *v1alpha1.AddonConfigurationSpec
+		url    string
+		err    error
+	}{
+		{name: "not found", url: ""},
+		{name: "not found, previously validated", cached: cached, url: "https://cached:9001"},
+		{name: "validated", cfg: newConfiguration(1, "https://current:9001", 1, nil), url: "https://current:9001"},
+		{name: "not validated, with a validated spec", cfg: newConfiguration(2, "https://current:9001", 1, validated), url: "https://validated:9001"},
+		{name: "not validated, previously validated", cfg: newConfiguration(2, "https://current:9001", 1, nil), cached: cached, url: "https://cached:9001"},
+		{name: "never validated", cfg: newConfiguration(1, "https://current:9001", 0, nil), err: ErrConfigurationNotValidated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+			if tt.cfg != nil {
+				builder = builder.WithObjects(tt.cfg)
+			}
+
+			r := NewServiceAccountReconciler(WithClient(builder.Build()), WithLogger(logr.Discard()), WithConfigurationName("default"))
+			if tt.cached != nil {
+				r.validatedConfiguration.Store(tt.cached)
+			}
+
+			cfg, err := r.activeConfiguration(context.Background())
+
+			switch {
+			case tt.err != nil:
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("expected the error %v, got %v", tt.err, err)
+				}
+
+				return
+			case err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var url string
+			if cfg.Spec.Proxy != nil {
+				url = cfg.Spec.Proxy.URL
+			}
+
+			if url != tt.url {
+				t.Fatalf("expected the proxy URL %q, got %q", tt.url, url)
+			}
+		})
+	}
+}
+
+func TestTokenExpiration(t *testing.T) {
+	expirationSeconds := int64(3600)
+
+	tests := []struct {
+		name       string
+		inherited  time.Duration
+		policy     v1alpha1.TokenPolicySpec
+		expiration time.Duration
+	}{
+		{name: "inherited token secret", policy: v1alpha1.TokenPolicySpec{}},
+		{name: "inherited token request", inherited: time.Hour, policy: v1alpha1.TokenPolicySpec{}, expiration: time.Hour},
+		{name: "token secret", inherited: time.Hour, policy: v1alpha1.TokenPolicySpec{Type: v1alpha1.ServiceAccountTokenType}},
+		{name: "token request", policy: v1alpha1.TokenPolicySpec{Type: v1alpha1.TokenRequestType}, expiration: DefaultTokenExpiration},
+		{name: "token request, inherited expiration", inherited: 2 * time.Hour, policy: v1alpha1.TokenPolicySpec{Type: v1alpha1.TokenRequestType}, expiration: 2 * time.Hour},
+		{name: "token request expiration", policy: v1alpha1.TokenPolicySpec{Type: v1alpha1.TokenRequestType, ExpirationSeconds: &expirationSeconds}, expiration: time.Hour},
+		{name: "expiration of an inherited token request", inherited: 2 * time.Hour, policy: v1alpha1.TokenPolicySpec{ExpirationSeconds: &expirationSeconds}, expiration: time.Hour},
+		{name: "expiration of an inherited token secret", policy: v1alpha1.TokenPolicySpec{ExpirationSeconds: &expirationSeconds}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if expiration := TokenExpiration(tt.inherited, tt.policy); expiration != tt.expiration {
+				t.Fatalf("expected the token expiration %s, got %s", tt.expiration, expiration)
+			}
+		})
+	}
+}
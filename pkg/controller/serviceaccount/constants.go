@@ -3,22 +3,146 @@
 
 package serviceaccount
 
+import "time"
+
 const (
 	ManagerName = "capsule-addon-fluxcd"
+	// FieldManager is the manager of the fields of the generated objects, applied with server-side apply.
+	FieldManager = ManagerName
+
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+	// LabelServiceAccountName and LabelServiceAccountNamespace identify the ServiceAccount from which a generated
+	// object originates.
+	LabelServiceAccountName      = "capsule.addon.fluxcd/serviceaccount-name"
+	LabelServiceAccountNamespace = "capsule.addon.fluxcd/serviceaccount-namespace"
+	// LabelTenant identifies the Tenant targeted by a generated object.
+	LabelTenant = "capsule.addon.fluxcd/tenant"
+	// AddonVersionAnnotationKey and ConfigHashAnnotationKey are set on the generated objects with the version of the
+	// addon, and the hash of the configuration, they have been generated with.
+	AddonVersionAnnotationKey = "capsule.addon.fluxcd/version"
+	ConfigHashAnnotationKey   = "capsule.addon.fluxcd/config-hash"
+	// AddonBuildAnnotationKey is set on the generated Secrets with the build information of the addon.
+	AddonBuildAnnotationKey = "capsule.addon.fluxcd/build"
+	// LabelComponent identifies the role of a generated object.
+	LabelComponent      = "app.kubernetes.io/component"
+	ComponentKubeconfig = "kubeconfig"
 
 	GlobalTenantResourceSuffix = "-kubeconfig"
+	TenantResourceSuffix       = "-kubeconfig"
+	TenantResourceResyncPeriod = 60 * time.Second
 
 	// #nosec G101
 	SecretNameSuffixKubeconfig = "-kubeconfig"
 	SecretNameSuffixToken      = "-token"
 	SecretKeyKubeconfig        = "kubeconfig"
+	// SecretNamePatternName is replaced with the ServiceAccount name in the kubeConfig Secret name templates.
+	SecretNamePatternName = "{name}"
+
+	// KubeconfigTokenExpirationAnnotationKey reports, on the kubeConfig Secret, the expiration of the token issued
+	// with the TokenRequest API.
+	KubeconfigTokenExpirationAnnotationKey = "capsule.addon.fluxcd/token-expiration"
+
+	DefaultClusterRoleName = "cluster-admin"
+
+	// ImpersonatorResourceUsers, ImpersonatorResourceServiceAccounts and ImpersonatorResourceGroups are the resources
+	// the ServiceAccount can be granted the impersonation on: the users and the groups by the impersonator ClusterRole,
+	// the serviceaccounts by the impersonator Role, in the ServiceAccount Namespace.
+	ImpersonatorResourceUsers           = "users"
+	ImpersonatorResourceServiceAccounts = "serviceaccounts"
+	ImpersonatorResourceGroups          = "groups"
+
+	// ImpersonatorRoleSuffix is the suffix of the impersonator Role, and RoleBinding, of a ServiceAccount.
+	ImpersonatorRoleSuffix = "-serviceaccount-impersonator"
 
 	ServiceAccountAddonAnnotationKey   = "capsule.addon.fluxcd/enabled"
 	ServiceAccountAddonAnnotationValue = "true"
 
+	// PausedAnnotationKey pauses, on a ServiceAccount or on a Tenant, the reconciliation of the ServiceAccounts: the
+	// generated objects are left as they are until the annotation is removed.
+	PausedAnnotationKey   = "capsule.addon.fluxcd/paused"
+	PausedAnnotationValue = "true"
+
 	ServiceAccountGlobalAnnotationKey   = "capsule.addon.fluxcd/kubeconfig-global"
 	ServiceAccountGlobalAnnotationValue = "true"
 
+	// ServiceAccountDistributionAnnotationKey selects, per ServiceAccount, the Capsule resource used to distribute the
+	// kubeConfig Secret across the Tenant Namespaces. Accepted values are DistributionGlobalTenantResource and
+	// DistributionTenantResource.
+	ServiceAccountDistributionAnnotationKey = "capsule.addon.fluxcd/kubeconfig-distribution"
+
+	DistributionGlobalTenantResource = "GlobalTenantResource"
+	DistributionTenantResource       = "TenantResource"
+
+	// ServiceAccountModeAnnotationKey selects, per ServiceAccount, the way Flux reconciles the Tenant resources as the
+	// ServiceAccount. Accepted values are ModeKubeconfig and ModeImpersonation.
+	ServiceAccountModeAnnotationKey = "capsule.addon.fluxcd/mode"
+
+	ModeKubeconfig    = "Kubeconfig"
+	ModeImpersonation = "Impersonation"
+
+	// FluxImpersonatorSuffix is the suffix of the Role and RoleBinding granting the Flux controllers the
+	// impersonation of the ServiceAccount.
+	FluxImpersonatorSuffix = "-flux-impersonator"
+	ComponentImpersonation = "impersonation"
+
+	// ServiceAccountBootstrapURLAnnotationKey and ServiceAccountBootstrapBucketNameAnnotationKey enable, per
+	// ServiceAccount, the bootstrap of a Flux source and Kustomization from the Git repository or OCI artifact URL,
+	// or from the bucket specified. The source kind is selected with ServiceAccountBootstrapSourceKindAnnotationKey.
+	ServiceAccountBootstrapSourceKindAnnotationKey     = "capsule.addon.fluxcd/bootstrap-source-kind"
+	ServiceAccountBootstrapURLAnnotationKey            = "capsule.addon.fluxcd/bootstrap-url"
+	ServiceAccountBootstrapBranchAnnotationKey         = "capsule.addon.fluxcd/bootstrap-branch"
+	ServiceAccountBootstrapTagAnnotationKey            = "capsule.addon.fluxcd/bootstrap-tag"
+	ServiceAccountBootstrapBucketNameAnnotationKey     = "capsule.addon.fluxcd/bootstrap-bucket-name"
+	ServiceAccountBootstrapBucketEndpointAnnotationKey = "capsule.addon.fluxcd/bootstrap-bucket-endpoint"
+	ServiceAccountBootstrapBucketProviderAnnotationKey = "capsule.addon.fluxcd/bootstrap-bucket-provider"
+	ServiceAccountBootstrapBucketRegionAnnotationKey   = "capsule.addon.fluxcd/bootstrap-bucket-region"
+	ServiceAccountBootstrapPathAnnotationKey           = "capsule.addon.fluxcd/bootstrap-path"
+	ServiceAccountBootstrapSecretAnnotationKey         = "capsule.addon.fluxcd/bootstrap-secret"
+	// ServiceAccountBootstrapVerifyAnnotationKey enables the verification of the source: the value is the provider of
+	// the OCI artifacts signatures, or the mode of the Git commits verification.
+	ServiceAccountBootstrapVerifyAnnotationKey       = "capsule.addon.fluxcd/bootstrap-verify"
+	ServiceAccountBootstrapVerifySecretAnnotationKey = "capsule.addon.fluxcd/bootstrap-verify-secret"
+
+	DefaultBootstrapBranch                = "main"
+	DefaultBootstrapTag                   = "latest"
+	DefaultBootstrapPath                  = "./"
+	DefaultBootstrapBucketProvider        = "generic"
+	DefaultBootstrapSourceInterval        = time.Minute
+	DefaultBootstrapKustomizationInterval = 10 * time.Minute
+	ComponentBootstrap                    = "bootstrap"
+
+	// TenantNotificationAddressAnnotationKey enables, on a Tenant, the notification of the failures of the
+	// Kustomizations in the Namespaces of its ServiceAccounts, to the address specified.
+	TenantNotificationAddressAnnotationKey = "capsule.addon.fluxcd/notification-address"
+
+	DefaultNotificationProviderType  = "generic"
+	DefaultNotificationEventSeverity = "error"
+	ComponentNotification            = "notification"
+	ComponentToken                   = "token"
+
+	// DriftCorrectedReason is the reason of the Events reporting the correction of a generated object.
+	DriftCorrectedReason = "DriftCorrected"
+	// ApplyConflictReason is the reason of the Events reporting the conflicts with other managers on the applied fields.
+	ApplyConflictReason = "ApplyConflict"
+	// PausedReason is the reason of the Events reporting the reconciliation of a ServiceAccount has been paused.
+	PausedReason = "Paused"
+	// ProxyVerificationFailedReason is the reason of the Events reporting the kubeConfig of a ServiceAccount failed
+	// to authenticate it against the Capsule Proxy.
+	ProxyVerificationFailedReason = "ProxyVerificationFailed"
+	// ProxyVerificationTimeout is the timeout of the request verifying a kubeConfig against the Capsule Proxy.
+	ProxyVerificationTimeout = 10 * time.Second
+	// DryRunReason is the reason of the Events reporting the writes skipped in the dry-run mode.
+	DryRunReason = "DryRun"
+
+	serviceAccountUsernamePrefix = "system:serviceaccount:"
+
+	// OwnerGroupPatternNamespace and OwnerGroupPatternName are the placeholders of the owner Group patterns,
+	// replaced with the ServiceAccount namespace and name.
+	OwnerGroupPatternNamespace = "{namespace}"
+	OwnerGroupPatternName      = "{name}"
+	// DefaultOwnerGroupPattern matches the Group of all the ServiceAccounts in the ServiceAccount Namespace.
+	DefaultOwnerGroupPattern = "system:serviceaccounts:" + OwnerGroupPatternNamespace
+
 	KubeconfigClusterName = "default"
 	KubeconfigUserName    = "default"
 	KubeconfigContextName = "default"
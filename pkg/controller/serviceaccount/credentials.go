@@ -0,0 +1,483 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+)
+
+// Settings is the desired configuration of the credential issued for a ServiceAccount.
+type Settings struct {
+	// ProxyURL is the server set in the kubeConfig.
+	ProxyURL string
+	// ClusterRoleName is the ClusterRole bound to the ServiceAccount in its Namespace.
+	ClusterRoleName string
+	// ImpersonatorResources are the resources the ServiceAccount is granted the impersonation of its own identity on,
+	// among ImpersonatorResourceUsers, ImpersonatorResourceServiceAccounts, and ImpersonatorResourceGroups.
+	ImpersonatorResources []string
+	// SecretName and SecretKey locate the kubeConfig in the ServiceAccount Namespace.
+	SecretName string
+	SecretKey  string
+	// Tenants restricts the Tenants served by the credential, when not empty.
+	Tenants []string
+	// AllowedTenants restricts the Tenants served by the credentials at platform-level, when not nil.
+	AllowedTenants *v1alpha1.AllowedTenantsSpec
+	// AllowedProxyURLs are the Capsule Proxy URLs the FluxTenantCredentials can set, on top of ProxyURL.
+	AllowedProxyURLs []string
+	// Mode is the way Flux reconciles the Tenant resources as the ServiceAccount: ModeKubeconfig, through the Capsule
+	// Proxy with the kubeConfig, or ModeImpersonation, impersonating the ServiceAccount.
+	Mode string
+	// Distribution is the Capsule resource used to distribute the kubeConfig Secret across the Tenant Namespaces.
+	// When empty, the kubeConfig Secret is not distributed.
+	Distribution string
+	// DistributionTenants restricts the Tenants the kubeConfig Secret is distributed to, when not empty.
+	DistributionTenants []string
+	// Bootstrap is the Git repository the Flux GitRepository and Kustomization are bootstrapped from.
+	// When nil, they are not bootstrapped.
+	Bootstrap *Bootstrap
+	// NotificationTemplate is rendered against the Tenant of the ServiceAccount Namespace into the Notification.
+	NotificationTemplate NotificationTemplate
+	// Notification is the Flux notification Provider of the failures of the Kustomizations in the ServiceAccount
+	// Namespace. When nil, the Provider and the Alert are not generated.
+	Notification *Notification
+	// TokenExpiration is the lifetime of the tokens issued with the TokenRequest API.
+	// When zero, the token of a ServiceAccount token Secret is used.
+	TokenExpiration time.Duration
+}
+
+// Credential is the outcome of the credential issued for a ServiceAccount.
+type Credential struct {
+	// Tenants served by the credential.
+	Tenants []string
+	// SecretName is the name of the kubeConfig Secret.
+	SecretName string
+	// TokenExpiration is the expiration of the token, zero when it does not expire.
+	TokenExpiration time.Time
+	// DistributedNamespaces are the Namespaces the kubeConfig Secret has been distributed to.
+	DistributedNamespaces []string
+	// ProxyVerified is true if the kubeConfig has been verified against the Capsule Proxy.
+	ProxyVerified bool
+	// RequeueAfter is the time after which the credential must be issued again, zero if not needed.
+	RequeueAfter time.Duration
+}
+
+// DefaultSettings returns the credential Settings of the ServiceAccount, as configured at reconciler-level and
+// by the AddonConfiguration in use, along with the override matching the Tenant of the ServiceAccount Namespace.
+func (r *ServiceAccountReconciler) DefaultSettings(ctx context.Context, sa *corev1.ServiceAccount) (Settings, error) {
+	settings := Settings{
+		ProxyURL:              r.proxyURL,
+		Mode:                  ModeKubeconfig,
+		ClusterRoleName:       DefaultClusterRoleName,
+		ImpersonatorResources: []string{ImpersonatorResourceUsers},
+		SecretName:            fmt.Sprintf("%s%s", sa.Name, SecretNameSuffixKubeconfig),
+		SecretKey:             SecretKeyKubeconfig,
+		NotificationTemplate: NotificationTemplate{
+			ProviderType:      DefaultNotificationProviderType,
+			EventSeverity:     DefaultNotificationEventSeverity,
+			AddressAnnotation: TenantNotificationAddressAnnotationKey,
+		},
+	}
+
+	cfg, err := r.activeConfiguration(ctx)
+	if err != nil {
+		return settings, errors.Wrap(err, "error getting the addon configuration")
+	}
+
+	applyDefaults(&settings, sa, cfg.Spec.AddonDefaults)
+	settings.AllowedTenants = cfg.Spec.AllowedTenants
+	settings.AllowedProxyURLs = cfg.Spec.AllowedProxyURLs
+
+	tnt, ok, err := r.namespaceTenant(ctx, sa)
+	if err != nil {
+		return settings, errors.Wrap(err, "error getting the tenant of the service account namespace")
+	}
+
+	if !ok {
+		return settings, nil
+	}
+
+	if override, found := tenantOverride(cfg, tnt); found {
+		applyDefaults(&settings, sa, override.AddonDefaults)
+	}
+
+	settings.Notification = settings.NotificationTemplate.render(tnt)
+
+	return settings, nil
+}
+
+// AnnotationSettings returns the credential Settings of the ServiceAccount, as configured with its annotations.
+func (r *ServiceAccountReconciler) AnnotationSettings(ctx context.Context, sa *corev1.ServiceAccount) (Settings, error) {
+	settings, err := r.DefaultSettings(ctx, sa)
+	if err != nil {
+		return settings, err
+	}
+
+	if sa.GetAnnotations()[ServiceAccountGlobalAnnotationKey] == ServiceAccountGlobalAnnotationValue {
+		settings.Distribution = r.distributionFor(sa)
+	}
+
+	if mode := sa.GetAnnotations()[ServiceAccountModeAnnotationKey]; mode != "" {
+		settings.Mode = mode
+	}
+
+	settings.Bootstrap = annotationBootstrap(sa)
+
+	return settings, nil
+}
+
+// Issue issues the credential of the ServiceAccount, a Tenant owner, according to the Settings specified:
+// it ensures the RBAC, the token, the kubeConfig Secret pointing to the Capsule Proxy, and its distribution across
+// the Tenant Namespaces.
+// ErrServiceAccountNotTenantOwner is returned when the ServiceAccount does not own any of the Tenants, after the
+// garbage collection of the kubeConfig distribution, while ErrServiceAccountTokenSecretEmpty is returned when the
+// token is not yet available.
+func (r *ServiceAccountReconciler) Issue(ctx context.Context, sa *corev1.ServiceAccount, settings Settings) (*Credential, error) {
+	// Get the Tenants owned by the ServiceAccount.
+	tenantList, err := r.listServiceAccountTenants(ctx, sa.Namespace, sa.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "error listing Tenants for owner")
+	}
+
+	tenants := allowedTenants(settings.AllowedTenants, filterTenants(tenantList.Items, settings.Tenants))
+	if len(tenants) == 0 {
+		if err = r.deleteGenerated(ctx, sa.Name, sa.Namespace); err != nil {
+			return nil, err
+		}
+
+		return nil, ErrServiceAccountNotTenantOwner
+	}
+
+	credential := new(Credential)
+
+	// Track the deletions of the dry-run mode, to report the recreated objects.
+	ctx = withPlan(ctx)
+
+	// The first Tenant owned by the SA is set as Namespace owner.
+	ctx = withOrigin(ctx, origin{tenant: tenants[0].Name, configHash: ConfigHash(settings)})
+
+	// Ensure the (Cluster)RoleBindings for the ServiceAccount.
+	if err = r.ensureRoles(ctx, sa, settings); err != nil {
+		return nil, errors.Wrap(err, "error ensuring the role bindings for the service account")
+	}
+
+	// Get the ServiceAccount's Namespace.
+	ns := new(corev1.Namespace)
+	if err = r.Client.Get(ctx, types.NamespacedName{Namespace: "", Name: sa.Namespace}, ns); err != nil {
+		return nil, errors.Wrap(err, "error getting the service account namespace")
+	}
+	// And set the first Tenant owned by the SA as Namespace owner.
+	if err = r.setNamespaceOwnerRef(ctx, sa, ns, tenants[0].DeepCopy()); err != nil {
+		return nil, errors.Wrap(err, "error setting the owner reference on the namespace")
+	}
+
+	for _, tnt := range tenants {
+		credential.Tenants = append(credential.Tenants, tnt.Name)
+	}
+
+	if settings.Mode == ModeImpersonation {
+		err = r.issueImpersonation(ctx, sa)
+	} else {
+		err = r.issueKubeconfig(ctx, sa, ns, tenants, settings, credential)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Bootstrap the Flux source and Kustomization.
+	if settings.Bootstrap != nil {
+		if err = r.ensureBootstrap(ctx, sa, settings); err != nil {
+			return nil, err
+		}
+	} else if err = r.deleteBootstrap(ctx, sa.Name, sa.Namespace); err != nil {
+		return nil, errors.Wrap(err, "error deleting the bootstrap")
+	}
+
+	// Notify the failures of the Kustomizations in the ServiceAccount Namespace.
+	if settings.Notification != nil {
+		if err = r.ensureNotification(ctx, sa, settings); err != nil {
+			return nil, err
+		}
+	} else if err = r.deleteNotification(ctx, sa.Name, sa.Namespace); err != nil {
+		return nil, errors.Wrap(err, "error deleting the notification")
+	}
+
+	if credential.DistributedNamespaces, err = r.distributedNamespaces(ctx, sa); err != nil {
+		return nil, errors.Wrap(err, "error listing the kubeConfig distributed namespaces")
+	}
+
+	return credential, nil
+}
+
+// issueKubeconfig issues the kubeConfig of the ServiceAccount pointing to the Capsule Proxy, and distributes it
+// across the Tenant Namespaces, filling the Credential with the outcome.
+func (r *ServiceAccountReconciler) issueKubeconfig(ctx context.Context, sa *corev1.ServiceAccount, ns *corev1.Namespace, tenants []capsulev1beta2.Tenant, settings Settings, credential *Credential) error {
+	// Revoke the impersonation granted in the impersonation mode.
+	if err := r.deleteFluxImpersonation(ctx, sa.Name, sa.Namespace); err != nil {
+		return errors.Wrap(err, "error deleting the flux impersonation")
+	}
+
+	// Ensure ServiceAccount token.
+	token, tokenExpiration, err := r.ensureToken(ctx, sa, settings)
+	if err != nil {
+		return err
+	}
+
+	// Build the kubeConfig for the ServiceAccount Tenant Owner.
+	config := r.buildKubeconfig(settings.ProxyURL, token)
+
+	configRaw, err := clientcmd.Write(*config)
+	if err != nil {
+		return errors.Wrap(err, "error building the tenant owner config")
+	}
+
+	// Verify the kubeConfig against the Capsule Proxy before publishing it: no token is issued in the dry-run mode.
+	if r.proxyVerification && !r.isDryRun(ctx) {
+		if err = r.verifyKubeconfig(ctx, sa, config); err != nil {
+			r.recordVerificationFailure(ctx, sa, err)
+
+			return err
+		}
+
+		credential.ProxyVerified = true
+	}
+
+	if err = r.ensureKubeconfigSecret(ctx, sa, settings, configRaw, tokenExpiration); err != nil {
+		return errors.Wrap(err, "error ensuring the kubeConfig secret")
+	}
+	// Delete the kubeConfig Secrets left by a previous naming.
+	if err = r.deleteStaleKubeconfigSecrets(ctx, sa, settings.SecretName); err != nil {
+		return errors.Wrap(err, "error deleting the stale kubeConfig secrets")
+	}
+	// If the option for distributing the kubeConfig to Tenant globally.
+	if settings.Distribution != "" {
+		if err = r.ensureKubeconfigDistribution(ctx, sa, ns, filterTenants(tenants, settings.DistributionTenants), settings.Distribution); err != nil {
+			return err
+		}
+	} else if err = r.deleteKubeconfigDistribution(ctx, sa.Name, sa.Namespace); err != nil {
+		return errors.Wrap(err, "error deleting the kubeConfig distribution")
+	}
+
+	credential.SecretName = settings.SecretName
+	credential.TokenExpiration = tokenExpiration
+
+	if !tokenExpiration.IsZero() {
+		credential.RequeueAfter = time.Until(tokenRotationTime(tokenExpiration, settings.TokenExpiration))
+	}
+
+	return nil
+}
+
+// issueImpersonation grants the Flux controllers the impersonation of the ServiceAccount, in place of the kubeConfig
+// which is deleted along with its distribution.
+func (r *ServiceAccountReconciler) issueImpersonation(ctx context.Context, sa *corev1.ServiceAccount) error {
+	if err := r.ensureFluxImpersonation(ctx, sa); err != nil {
+		return errors.Wrap(err, "error ensuring the flux impersonation")
+	}
+
+	if err := r.deleteStaleKubeconfigSecrets(ctx, sa, ""); err != nil {
+		return errors.Wrap(err, "error deleting the kubeConfig secrets")
+	}
+
+	if err := r.deleteKubeconfigDistribution(ctx, sa.Name, sa.Namespace); err != nil {
+		return errors.Wrap(err, "error deleting the kubeConfig distribution")
+	}
+
+	return nil
+}
+
+// deleteGenerated deletes all the objects generated for the ServiceAccount of which the name and the namespace are
+// specified as arguments, once it's not served anymore: the kubeConfig and token Secrets, the RBAC, the kubeConfig
+// distribution, the bootstrap and the notification.
+// The generated kinds are deleted in the reverse order, the dependent objects first, such as the Kustomization before
+// its source.
+func (r *ServiceAccountReconciler) deleteGenerated(ctx context.Context, saName, saNamespace string) error {
+	generated, err := r.Generated(ctx, saNamespace, saName)
+	if err != nil {
+		return errors.Wrap(err, "error listing the generated objects")
+	}
+
+	for i := len(generated) - 1; i >= 0; i-- {
+		if err = r.delete(ctx, nil, generated[i]); err != nil {
+			return errors.Wrapf(err, "error deleting the generated %s %s", strings.ToLower(generated[i].GetObjectKind().GroupVersionKind().Kind), generated[i].GetName())
+		}
+	}
+
+	return nil
+}
+
+// deleteOrphaned deletes the cluster-scoped objects generated for the deleted ServiceAccount of which the namespace
+// and the name are specified as arguments, such as the impersonator ClusterRole and the GlobalTenantResources: the
+// namespaced ones are garbage collected through their owner references.
+func (r *ServiceAccountReconciler) deleteOrphaned(ctx context.Context, saNamespace, saName string) error {
+	generated, err := r.Generated(ctx, saNamespace, saName)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range generated {
+		if obj.GetNamespace() != "" {
+			continue
+		}
+
+		r.logger(ctx).Info("Deleting orphaned object", "kind", obj.GetObjectKind().GroupVersionKind().Kind, "name", obj.GetName())
+
+		if err = r.delete(ctx, nil, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ensureKubeconfigSecret ensures the kubeConfig Secret of the ServiceAccount, with the content specified.
+func (r *ServiceAccountReconciler) ensureKubeconfigSecret(ctx context.Context, sa *corev1.ServiceAccount, settings Settings, configRaw []byte, tokenExpiration time.Time) error {
+	secret, err := r.desiredKubeconfigSecret(sa, settings, configRaw, tokenExpiration)
+	if err != nil {
+		return err
+	}
+
+	// The expiration annotation is removed by the server-side apply, once not applied anymore.
+	expiration := secret.Annotations[KubeconfigTokenExpirationAnnotationKey]
+
+	return r.ensure(ctx, sa, secret, func(current client.Object, drift *driftTracker) {
+		currentSecret := current.(*corev1.Secret) //nolint:forcetypeassert
+		// The data is expected to change along with the token, once rotated.
+		if currentSecret.Annotations[KubeconfigTokenExpirationAnnotationKey] == expiration {
+			drift.track("data", currentSecret.Data[settings.SecretKey], configRaw)
+		}
+	})
+}
+
+// desiredKubeconfigSecret returns the desired kubeConfig Secret of the ServiceAccount, with the content specified.
+func (r *ServiceAccountReconciler) desiredKubeconfigSecret(sa *corev1.ServiceAccount, settings Settings, configRaw []byte, tokenExpiration time.Time) (*corev1.Secret, error) {
+	// The labels are used to select the Secret for the distribution across Tenant Namespaces.
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      settings.SecretName,
+			Namespace: sa.Namespace,
+			Labels:    kubeconfigSecretLabels(sa),
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			settings.SecretKey: configRaw,
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(sa, secret, r.Client.Scheme()); err != nil {
+		return nil, err
+	}
+
+	if !tokenExpiration.IsZero() {
+		secret.Annotations = map[string]string{KubeconfigTokenExpirationAnnotationKey: tokenExpiration.UTC().Format(time.RFC3339)}
+	}
+
+	return secret, nil
+}
+
+// deleteStaleKubeconfigSecrets deletes the kubeConfig Secrets generated for the ServiceAccount, other than the one of
+// which the name is specified as argument.
+func (r *ServiceAccountReconciler) deleteStaleKubeconfigSecrets(ctx context.Context, sa *corev1.ServiceAccount, name string) error {
+	secretList := new(corev1.SecretList)
+	if err := r.Client.List(ctx, secretList, client.InNamespace(sa.Namespace), client.MatchingLabels(kubeconfigSecretLabels(sa))); err != nil {
+		return err
+	}
+
+	for i := range secretList.Items {
+		if secretList.Items[i].Name == name {
+			continue
+		}
+
+		if err := r.delete(ctx, sa, &secretList.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// distributedNamespaces returns the Namespaces the kubeConfig Secret of the ServiceAccount has been distributed to,
+// as reported by the Capsule resources distributing it.
+func (r *ServiceAccountReconciler) distributedNamespaces(ctx context.Context, sa *corev1.ServiceAccount) ([]string, error) {
+	var items []capsulev1beta2.ProcessedItems
+
+	gtrList := new(capsulev1beta2.GlobalTenantResourceList)
+	if err := r.Client.List(ctx, gtrList, client.MatchingLabels{
+		LabelManagedBy:               ManagerName,
+		LabelServiceAccountName:      sa.Name,
+		LabelServiceAccountNamespace: sa.Namespace,
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, gtr := range gtrList.Items {
+		items = append(items, gtr.Status.ProcessedItems)
+	}
+
+	tr := new(capsulev1beta2.TenantResource)
+	if err := r.Client.Get(ctx, types.NamespacedName{
+		Namespace: sa.Namespace,
+		Name:      fmt.Sprintf("%s%s", sa.Name, TenantResourceSuffix),
+	}, tr); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+
+	items = append(items, tr.Status.ProcessedItems)
+
+	return processedNamespaces(items...), nil
+}
+
+// processedNamespaces returns the sorted Namespaces of the Secrets replicated by the Capsule resources, as reported by
+// their processed items.
+func processedNamespaces(items ...capsulev1beta2.ProcessedItems) []string {
+	namespaces := sets.New[string]()
+
+	for _, processed := range items {
+		for _, item := range processed {
+			if item.Kind == "Secret" {
+				namespaces.Insert(item.Namespace)
+			}
+		}
+	}
+
+	out := namespaces.UnsortedList()
+	sort.Strings(out)
+
+	return out
+}
+
+// filterTenants returns the Tenants of which the name is listed, or all of them if the list is empty.
+func filterTenants(tenants []capsulev1beta2.Tenant, names []string) []capsulev1beta2.Tenant {
+	if len(names) == 0 {
+		return tenants
+	}
+
+	allowed := sets.New[string](names...)
+
+	var out []capsulev1beta2.Tenant
+
+	for _, tnt := range tenants {
+		if allowed.Has(tnt.Name) {
+			out = append(out, tnt)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,78 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDeleteGenerated(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := capsulev1beta2.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "oil-system", Name: "gitops-reconciler"}}
+	other := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "oil-system", Name: "other-reconciler"}}
+
+	objectMeta := func(sa *corev1.ServiceAccount, namespace, name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: rbacLabels(nil, sa)}
+	}
+
+	generated := []client.Object{
+		&corev1.Secret{ObjectMeta: objectMeta(sa, sa.Namespace, "gitops-reconciler-kubeconfig")},
+		&corev1.Secret{ObjectMeta: objectMeta(sa, sa.Namespace, "gitops-reconciler-token")},
+		&rbacv1.RoleBinding{ObjectMeta: objectMeta(sa, sa.Namespace, "gitops-reconciler")},
+		&rbacv1.Role{ObjectMeta: objectMeta(sa, sa.Namespace, "gitops-reconciler-flux-impersonator")},
+		&rbacv1.RoleBinding{ObjectMeta: objectMeta(sa, sa.Namespace, "gitops-reconciler-flux-impersonator")},
+		&rbacv1.ClusterRole{ObjectMeta: objectMeta(sa, "", "oil-system-gitops-reconciler-impersonator")},
+		&rbacv1.ClusterRoleBinding{ObjectMeta: objectMeta(sa, "", "oil-system-gitops-reconciler-impersonator")},
+		&capsulev1beta2.GlobalTenantResource{ObjectMeta: objectMeta(sa, "", "oil-gitops-reconciler-kubeconfig")},
+	}
+	retained := []client.Object{
+		&corev1.Secret{ObjectMeta: objectMeta(other, other.Namespace, "other-reconciler-kubeconfig")},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: sa.Namespace, Name: "gitops-reconciler-credentials"}},
+	}
+
+	r := NewServiceAccountReconciler(WithLogger(logr.Discard()))
+
+	builder := fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(generated, retained...)...)
+	for _, idx := range r.Indexers() {
+		builder = builder.WithIndex(idx.Object(), idx.Field(), idx.Func())
+	}
+
+	r.Client = builder.Build()
+
+	if err := r.deleteGenerated(context.Background(), sa.Name, sa.Namespace); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, obj := range generated {
+		if err := r.Client.Get(context.Background(), client.ObjectKeyFromObject(obj), obj); !apierrors.IsNotFound(err) {
+			t.Fatalf("expected the %T %s to be deleted, got %v", obj, client.ObjectKeyFromObject(obj), err)
+		}
+	}
+
+	for _, obj := range retained {
+		if err := r.Client.Get(context.Background(), client.ObjectKeyFromObject(obj), obj); err != nil {
+			t.Fatalf("expected the %T %s to be retained, got %v", obj, client.ObjectKeyFromObject(obj), err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// ensureKubeconfigDistribution ensures the Capsule resources to distribute the kubeConfig Secret across the
+// Namespaces of the Tenants owned by the ServiceAccount.
+// The Tenant owning the ServiceAccount Namespace is served by a namespaced TenantResource, when it's the selected
+// distribution, while the other Tenants are always served by a cluster-scoped GlobalTenantResource.
+// GlobalTenantResources generated for Tenants not served anymore are deleted.
+func (r *ServiceAccountReconciler) ensureKubeconfigDistribution(ctx context.Context, sa *corev1.ServiceAccount, ns *corev1.Namespace, tenants []capsulev1beta2.Tenant, distribution string) error {
+	desired := sets.New[string]()
+
+	for _, tenant := range tenants {
+		name := globalTenantResourceName(sa, tenant.Name)
+
+		if isNamespaceOwner(ns, &tenant) {
+			if distribution == DistributionTenantResource {
+				if err := r.ensureTenantResource(ctx, sa); err != nil {
+					return errors.Wrap(err, "error ensuring the kubeConfig tenantresource")
+				}
+				// Migrate from the GlobalTenantResource previously used for the same Tenant.
+				if err := r.deleteGlobalTenantResource(ctx, name); err != nil {
+					return errors.Wrap(err, "error deleting the migrated kubeConfig globaltenantresource")
+				}
+
+				continue
+			}
+			// Migrate from the TenantResource previously used for the same Tenant.
+			if err := r.deleteTenantResource(ctx, sa.Name, sa.Namespace); err != nil {
+				return errors.Wrap(err, "error deleting the migrated kubeConfig tenantresource")
+			}
+		}
+		// Ensure the GlobalTenantResource to distribute the kubeConfig Secret.
+		if err := r.ensureGlobalTenantResource(ctx, sa, tenant.Name); err != nil {
+			return errors.Wrap(err, "error ensuring the kubeConfig globaltenantresource")
+		}
+
+		desired.Insert(name)
+	}
+
+	if err := r.deleteStaleGlobalTenantResources(ctx, sa.Name, sa.Namespace, desired); err != nil {
+		return errors.Wrap(err, "error deleting the stale kubeConfig globaltenantresources")
+	}
+
+	return nil
+}
+
+// deleteKubeconfigDistribution deletes all the Capsule resources distributing the kubeConfig Secret of the
+// ServiceAccount of which the name and the namespace are specified as arguments.
+func (r *ServiceAccountReconciler) deleteKubeconfigDistribution(ctx context.Context, saName, saNamespace string) error {
+	if err := r.deleteTenantResource(ctx, saName, saNamespace); err != nil {
+		return err
+	}
+
+	return r.deleteStaleGlobalTenantResources(ctx, saName, saNamespace, sets.New[string]())
+}
+
+// kubeconfigTenantResourceSpec returns the Capsule TenantResourceSpec replicating the kubeConfig Secret of the
+// ServiceAccount, referenced by selector from the ServiceAccount Namespace.
+func kubeconfigTenantResourceSpec(sa *corev1.ServiceAccount) capsulev1beta2.TenantResourceSpec {
+	// The pruning is set explicitly, to not depend on the default of the API.
+	pruningOnDelete := true
+
+	return capsulev1beta2.TenantResourceSpec{
+		ResyncPeriod:    metav1.Duration{Duration: TenantResourceResyncPeriod},
+		PruningOnDelete: &pruningOnDelete,
+		Resources: []capsulev1beta2.ResourceSpec{{
+			// The source Secret lives in the ServiceAccount Namespace: skip it to not overwrite the original.
+			NamespaceSelector: &metav1.LabelSelector{
+				MatchExpressions: []metav1.LabelSelectorRequirement{{
+					Key:      corev1.LabelMetadataName,
+					Operator: metav1.LabelSelectorOpNotIn,
+					Values:   []string{sa.Namespace},
+				}},
+			},
+			NamespacedItems: []capsulev1beta2.ObjectReference{{
+				ObjectReferenceAbstract: capsulev1beta2.ObjectReferenceAbstract{
+					Kind:       "Secret",
+					Namespace:  sa.Namespace,
+					APIVersion: corev1.SchemeGroupVersion.String(),
+				},
+				Selector: metav1.LabelSelector{
+					MatchLabels: kubeconfigSecretLabels(sa),
+				},
+			}},
+		}},
+	}
+}
+
+// kubeconfigSecretLabels returns the labels identifying the kubeConfig Secret of the ServiceAccount.
+func kubeconfigSecretLabels(sa *corev1.ServiceAccount) map[string]string {
+	return map[string]string{
+		LabelManagedBy:               ManagerName,
+		LabelComponent:               ComponentKubeconfig,
+		LabelServiceAccountName:      sa.Name,
+		LabelServiceAccountNamespace: sa.Namespace,
+	}
+}
+
+// distributionFor returns the Capsule resource used to distribute the kubeConfig Secret of the ServiceAccount,
+// falling back to the reconciler default when the ServiceAccount does not specify a valid one.
+func (r *ServiceAccountReconciler) distributionFor(sa *corev1.ServiceAccount) string {
+	switch v := sa.GetAnnotations()[ServiceAccountDistributionAnnotationKey]; v {
+	case DistributionGlobalTenantResource, DistributionTenantResource:
+		return v
+	}
+
+	if r.distribution == DistributionTenantResource {
+		return DistributionTenantResource
+	}
+
+	return DistributionGlobalTenantResource
+}
+
+// isNamespaceOwner returns true if the Tenant is the controller of the Namespace.
+func isNamespaceOwner(ns *corev1.Namespace, tnt *capsulev1beta2.Tenant) bool {
+	owner := metav1.GetControllerOf(ns)
+
+	return owner != nil && owner.Kind == "Tenant" && owner.Name == tnt.Name
+}
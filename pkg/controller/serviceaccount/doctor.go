@@ -0,0 +1,366 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CheckStatus is the outcome of a diagnostic Check.
+type CheckStatus string
+
+const (
+	CheckPassed  CheckStatus = "pass"
+	CheckFailed  CheckStatus = "fail"
+	CheckSkipped CheckStatus = "skip"
+)
+
+// Check is a diagnostic check of the credential issued for a ServiceAccount.
+type Check struct {
+	Name    string      `json:"name"`
+	Status  CheckStatus `json:"status"`
+	Message string      `json:"message"`
+}
+
+// Diagnosis is the outcome of the diagnostic checks of the credential issued for a ServiceAccount.
+type Diagnosis struct {
+	Namespace      string  `json:"namespace"`
+	ServiceAccount string  `json:"serviceAccount"`
+	Checks         []Check `json:"checks"`
+}
+
+// Failed returns true if any of the checks failed.
+func (d *Diagnosis) Failed() bool {
+	for _, check := range d.Checks {
+		if check.Status == CheckFailed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d *Diagnosis) record(name string, status CheckStatus, format string, args ...interface{}) {
+	d.Checks = append(d.Checks, Check{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+}
+
+// Diagnose runs the diagnostic checks of the credential issued for the ServiceAccount with the Settings specified,
+// using the same lookups as Issue, without writing any object: its enablement, the Tenant ownership, the RBAC, the
+// token, the kubeConfig Secret, its distribution, and the authentication of the ServiceAccount through the Capsule Proxy
+// with it, or the impersonation granted to the Flux controllers in the impersonation mode.
+func (r *ServiceAccountReconciler) Diagnose(ctx context.Context, sa *corev1.ServiceAccount, settings Settings) *Diagnosis {
+	diagnosis := &Diagnosis{Namespace: sa.Namespace, ServiceAccount: sa.Name}
+
+	r.diagnoseEnablement(ctx, sa, diagnosis)
+
+	tenants := r.diagnoseTenants(ctx, sa, settings, diagnosis)
+
+	r.diagnoseRoles(ctx, sa, settings, diagnosis)
+
+	if settings.Mode == ModeImpersonation {
+		r.diagnoseFluxImpersonation(ctx, sa, diagnosis)
+
+		for _, name := range []string{"token-secret", "kubeconfig-secret", "distribution", "proxy"} {
+			diagnosis.record(name, CheckSkipped, "not used in the %s mode", ModeImpersonation)
+		}
+
+		return diagnosis
+	}
+
+	for _, name := range []string{"flux-impersonator-role", "flux-impersonator-rolebinding"} {
+		diagnosis.record(name, CheckSkipped, "not used in the %s mode", settings.Mode)
+	}
+
+	r.diagnoseToken(ctx, sa, settings, diagnosis)
+	raw := r.diagnoseKubeconfigSecret(ctx, sa, settings, diagnosis)
+	r.diagnoseDistribution(ctx, sa, settings, tenants, diagnosis)
+	r.diagnoseProxy(ctx, sa, raw, diagnosis)
+
+	return diagnosis
+}
+
+func (r *ServiceAccountReconciler) diagnoseEnablement(ctx context.Context, sa *corev1.ServiceAccount, diagnosis *Diagnosis) {
+	managed, err := r.isCredentialManaged(ctx, sa)
+
+	switch {
+	case err != nil:
+		diagnosis.record("enabled", CheckFailed, "error listing FluxTenantCredentials: %s", err)
+	case managed:
+		diagnosis.record("enabled", CheckPassed, "referred by a FluxTenantCredential")
+	case IsAddonEnabled(sa):
+		diagnosis.record("enabled", CheckPassed, "annotated with %s=%s", ServiceAccountAddonAnnotationKey, ServiceAccountAddonAnnotationValue)
+	default:
+		diagnosis.record("enabled", CheckFailed, "neither annotated with %s=%s nor referred by a FluxTenantCredential", ServiceAccountAddonAnnotationKey, ServiceAccountAddonAnnotationValue)
+	}
+}
+
+func (r *ServiceAccountReconciler) diagnoseTenants(ctx context.Context, sa *corev1.ServiceAccount, settings Settings, diagnosis *Diagnosis) []capsulev1beta2.Tenant {
+	tenantList, err := r.listServiceAccountTenants(ctx, sa.Namespace, sa.Name)
+	if err != nil {
+		diagnosis.record("tenant-ownership", CheckFailed, "error listing Tenants for owner: %s", err)
+
+		return nil
+	}
+
+	tenants := allowedTenants(settings.AllowedTenants, filterTenants(tenantList.Items, settings.Tenants))
+	if len(tenants) == 0 {
+		diagnosis.record("tenant-ownership", CheckFailed, "not an owner of any served Tenant, out of %d owned", len(tenantList.Items))
+
+		return nil
+	}
+
+	names := make([]string, 0, len(tenants))
+	for _, tnt := range tenants {
+		names = append(names, tnt.Name)
+	}
+
+	diagnosis.record("tenant-ownership", CheckPassed, "serving Tenants %s", strings.Join(names, ", "))
+
+	return tenants
+}
+
+func (r *ServiceAccountReconciler) diagnoseRoles(ctx context.Context, sa *corev1.ServiceAccount, settings Settings, diagnosis *Diagnosis) {
+	rb := new(rbacv1.RoleBinding)
+
+	switch err := r.Client.Get(ctx, types.NamespacedName{Namespace: sa.Namespace, Name: sa.Name}, rb); {
+	case err != nil:
+		diagnosis.record("rolebinding", CheckFailed, "error getting RoleBinding %s: %s", sa.Name, err)
+	case rb.RoleRef.Name != settings.ClusterRoleName:
+		diagnosis.record("rolebinding", CheckFailed, "RoleBinding %s binds ClusterRole %s in place of %s", sa.Name, rb.RoleRef.Name, settings.ClusterRoleName)
+	default:
+		diagnosis.record("rolebinding", CheckPassed, "RoleBinding %s binds ClusterRole %s", sa.Name, settings.ClusterRoleName)
+	}
+
+	clusterRules, namespacedRules := impersonatorRules(sa, settings.ImpersonatorResources)
+
+	name := impersonatorClusterRoleName(sa)
+	cr := new(rbacv1.ClusterRole)
+
+	switch err := r.Client.Get(ctx, client.ObjectKey{Name: name}, cr); {
+	case err != nil:
+		diagnosis.record("impersonator-clusterrole", CheckFailed, "error getting ClusterRole %s: %s", name, err)
+	case !equality.Semantic.DeepEqual(cr.Rules, clusterRules):
+		diagnosis.record("impersonator-clusterrole", CheckFailed, "ClusterRole %s rules drifted from the desired ones", name)
+	default:
+		diagnosis.record("impersonator-clusterrole", CheckPassed, "ClusterRole %s grants the cluster-wide impersonation", name)
+	}
+
+	crb := new(rbacv1.ClusterRoleBinding)
+
+	switch err := r.Client.Get(ctx, client.ObjectKey{Name: name}, crb); {
+	case err != nil:
+		diagnosis.record("impersonator-clusterrolebinding", CheckFailed, "error getting ClusterRoleBinding %s: %s", name, err)
+	case crb.RoleRef.Name != name:
+		diagnosis.record("impersonator-clusterrolebinding", CheckFailed, "ClusterRoleBinding %s binds ClusterRole %s", name, crb.RoleRef.Name)
+	default:
+		diagnosis.record("impersonator-clusterrolebinding", CheckPassed, "ClusterRoleBinding %s binds ClusterRole %s", name, name)
+	}
+
+	r.diagnoseImpersonatorRole(ctx, sa, namespacedRules, diagnosis)
+}
+
+func (r *ServiceAccountReconciler) diagnoseImpersonatorRole(ctx context.Context, sa *corev1.ServiceAccount, rules []rbacv1.PolicyRule, diagnosis *Diagnosis) {
+	name := impersonatorRoleName(sa)
+
+	if len(rules) == 0 {
+		diagnosis.record("impersonator-role", CheckSkipped, "the impersonation of the ServiceAccount is not requested")
+
+		return
+	}
+
+	role := new(rbacv1.Role)
+
+	switch err := r.Client.Get(ctx, types.NamespacedName{Namespace: sa.Namespace, Name: name}, role); {
+	case err != nil:
+		diagnosis.record("impersonator-role", CheckFailed, "error getting Role %s: %s", name, err)
+	case !equality.Semantic.DeepEqual(role.Rules, rules):
+		diagnosis.record("impersonator-role", CheckFailed, "Role %s rules drifted from the desired ones", name)
+	default:
+		diagnosis.record("impersonator-role", CheckPassed, "Role %s grants the impersonation of the ServiceAccount", name)
+	}
+
+	rb := new(rbacv1.RoleBinding)
+
+	switch err := r.Client.Get(ctx, types.NamespacedName{Namespace: sa.Namespace, Name: name}, rb); {
+	case err != nil:
+		diagnosis.record("impersonator-rolebinding", CheckFailed, "error getting RoleBinding %s: %s", name, err)
+	case rb.RoleRef.Kind != "Role" || rb.RoleRef.Name != name:
+		diagnosis.record("impersonator-rolebinding", CheckFailed, "RoleBinding %s binds %s %s", name, rb.RoleRef.Kind, rb.RoleRef.Name)
+	default:
+		diagnosis.record("impersonator-rolebinding", CheckPassed, "RoleBinding %s binds Role %s", name, name)
+	}
+}
+
+// diagnoseFluxImpersonation checks the Role and the RoleBinding granting the Flux controllers the impersonation of the
+// ServiceAccount.
+func (r *ServiceAccountReconciler) diagnoseFluxImpersonation(ctx context.Context, sa *corev1.ServiceAccount, diagnosis *Diagnosis) {
+	name := fluxImpersonatorName(sa.Name)
+	role := new(rbacv1.Role)
+
+	switch err := r.Client.Get(ctx, types.NamespacedName{Namespace: sa.Namespace, Name: name}, role); {
+	case err != nil:
+		diagnosis.record("flux-impersonator-role", CheckFailed, "error getting Role %s: %s", name, err)
+	case !equality.Semantic.DeepEqual(role.Rules, fluxImpersonatorRules(sa)):
+		diagnosis.record("flux-impersonator-role", CheckFailed, "Role %s rules drifted from the desired ones", name)
+	default:
+		diagnosis.record("flux-impersonator-role", CheckPassed, "Role %s grants the impersonation of the ServiceAccount", name)
+	}
+
+	rb := new(rbacv1.RoleBinding)
+
+	switch err := r.Client.Get(ctx, types.NamespacedName{Namespace: sa.Namespace, Name: name}, rb); {
+	case err != nil:
+		diagnosis.record("flux-impersonator-rolebinding", CheckFailed, "error getting RoleBinding %s: %s", name, err)
+	case rb.RoleRef.Kind != "Role" || rb.RoleRef.Name != name:
+		diagnosis.record("flux-impersonator-rolebinding", CheckFailed, "RoleBinding %s binds %s %s", name, rb.RoleRef.Kind, rb.RoleRef.Name)
+	case !equality.Semantic.DeepEqual(rb.Subjects, r.fluxControllers):
+		diagnosis.record("flux-impersonator-rolebinding", CheckFailed, "RoleBinding %s subjects drifted from the Flux controllers", name)
+	default:
+		diagnosis.record("flux-impersonator-rolebinding", CheckPassed, "RoleBinding %s binds Role %s to the Flux controllers", name, name)
+	}
+}
+
+func (r *ServiceAccountReconciler) diagnoseToken(ctx context.Context, sa *corev1.ServiceAccount, settings Settings, diagnosis *Diagnosis) {
+	if settings.TokenExpiration > 0 {
+		diagnosis.record("token-secret", CheckSkipped, "tokens are requested with the TokenRequest API, lasting %s", settings.TokenExpiration)
+
+		return
+	}
+
+	tokenSecret, err := r.getSATokenSecret(ctx, sa.Name, sa.Namespace)
+
+	switch {
+	case err != nil:
+		diagnosis.record("token-secret", CheckFailed, "%s", err)
+	case len(tokenSecret.Data[corev1.ServiceAccountTokenKey]) == 0:
+		diagnosis.record("token-secret", CheckFailed, "Secret %s: %s", tokenSecret.Name, ErrServiceAccountTokenSecretEmpty)
+	default:
+		diagnosis.record("token-secret", CheckPassed, "Secret %s holds the token", tokenSecret.Name)
+	}
+}
+
+// diagnoseKubeconfigSecret checks the kubeConfig Secret, returning the raw kubeConfig when valid.
+func (r *ServiceAccountReconciler) diagnoseKubeconfigSecret(ctx context.Context, sa *corev1.ServiceAccount, settings Settings, diagnosis *Diagnosis) []byte {
+	secret := new(corev1.Secret)
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: sa.Namespace, Name: settings.SecretName}, secret); err != nil {
+		diagnosis.record("kubeconfig-secret", CheckFailed, "error getting Secret %s: %s", settings.SecretName, err)
+
+		return nil
+	}
+
+	raw := secret.Data[settings.SecretKey]
+
+	config, err := clientcmd.Load(raw)
+	if err != nil {
+		diagnosis.record("kubeconfig-secret", CheckFailed, "Secret %s key %s is not a valid kubeConfig: %s", settings.SecretName, settings.SecretKey, err)
+
+		return nil
+	}
+
+	if _, ok := kubeconfigToken(raw); !ok {
+		diagnosis.record("kubeconfig-secret", CheckFailed, "Secret %s kubeConfig has no token", settings.SecretName)
+
+		return nil
+	}
+
+	if cluster, ok := config.Clusters[KubeconfigClusterName]; !ok || cluster.Server != settings.ProxyURL {
+		diagnosis.record("kubeconfig-secret", CheckFailed, "Secret %s kubeConfig does not point to %s", settings.SecretName, settings.ProxyURL)
+
+		return nil
+	}
+
+	if value, ok := secret.GetAnnotations()[KubeconfigTokenExpirationAnnotationKey]; ok {
+		if expiration, parseErr := time.Parse(time.RFC3339, value); parseErr == nil && time.Now().After(expiration) {
+			diagnosis.record("kubeconfig-secret", CheckFailed, "Secret %s token expired at %s", settings.SecretName, value)
+
+			return nil
+		}
+	}
+
+	diagnosis.record("kubeconfig-secret", CheckPassed, "Secret %s holds the kubeConfig pointing to %s", settings.SecretName, settings.ProxyURL)
+
+	return raw
+}
+
+func (r *ServiceAccountReconciler) diagnoseDistribution(ctx context.Context, sa *corev1.ServiceAccount, settings Settings, tenants []capsulev1beta2.Tenant, diagnosis *Diagnosis) {
+	if settings.Distribution == "" {
+		diagnosis.record("distribution", CheckSkipped, "the kubeConfig is not distributed")
+
+		return
+	}
+
+	ns := new(corev1.Namespace)
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: sa.Namespace}, ns); err != nil {
+		diagnosis.record("distribution", CheckFailed, "error getting Namespace %s: %s", sa.Namespace, err)
+
+		return
+	}
+
+	var found, missing []string
+
+	for _, tnt := range filterTenants(tenants, settings.DistributionTenants) {
+		var obj client.Object = &capsulev1beta2.GlobalTenantResource{}
+
+		kind, key := "GlobalTenantResource", client.ObjectKey{Name: globalTenantResourceName(sa, tnt.Name)}
+
+		if settings.Distribution == DistributionTenantResource && isNamespaceOwner(ns, &tnt) {
+			obj = &capsulev1beta2.TenantResource{}
+			kind, key = "TenantResource", client.ObjectKey{Namespace: sa.Namespace, Name: sa.Name + TenantResourceSuffix}
+		}
+
+		if err := r.Client.Get(ctx, key, obj); err != nil {
+			missing = append(missing, fmt.Sprintf("%s %s", kind, key.Name))
+
+			continue
+		}
+
+		found = append(found, fmt.Sprintf("%s %s", kind, key.Name))
+	}
+
+	if len(missing) > 0 {
+		diagnosis.record("distribution", CheckFailed, "missing %s", strings.Join(missing, ", "))
+
+		return
+	}
+
+	diagnosis.record("distribution", CheckPassed, "distributed with %s", strings.Join(found, ", "))
+}
+
+// diagnoseProxy checks the token of the raw kubeConfig specified authenticates the ServiceAccount through the Capsule
+// Proxy, issuing a SelfSubjectReview with it, as the verification performed before publishing the kubeConfig.
+func (r *ServiceAccountReconciler) diagnoseProxy(ctx context.Context, sa *corev1.ServiceAccount, raw []byte, diagnosis *Diagnosis) {
+	if raw == nil {
+		diagnosis.record("proxy", CheckSkipped, "no valid kubeConfig to reach the Capsule Proxy with")
+
+		return
+	}
+
+	config, err := clientcmd.Load(raw)
+	if err != nil {
+		diagnosis.record("proxy", CheckFailed, "error loading the kubeConfig: %s", err)
+
+		return
+	}
+
+	server := config.Clusters[KubeconfigClusterName].Server
+
+	if err = r.verifyKubeconfig(ctx, sa, config); err != nil {
+		diagnosis.record("proxy", CheckFailed, "%s: %s", server, err)
+
+		return
+	}
+
+	diagnosis.record("proxy", CheckPassed, "%s authenticates the ServiceAccount as %s", server, serviceAccountUsername(sa.Namespace, sa.Name))
+}
@@ -0,0 +1,118 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"encoding/pem"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDiagnoseProxy(t *testing.T) {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "oil-system", Name: "gitops-reconciler"}}
+
+	proxy := newProxy(t, map[string]string{
+		"Bearer valid": serviceAccountUsername(sa.Namespace, sa.Name),
+		"Bearer other": serviceAccountUsername(sa.Namespace, "other"),
+	})
+
+	proxyCA := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: proxy.Certificate().Raw}))
+
+	tests := []struct {
+		name   string
+		token  string
+		status CheckStatus
+	}{
+		{name: "token authenticating the ServiceAccount", token: "valid", status: CheckPassed},
+		// The Capsule Proxy is reachable, but the token authenticates another identity.
+		{name: "token authenticating another ServiceAccount", token: "other", status: CheckFailed},
+		{name: "token not authenticated", token: "invalid", status: CheckFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewServiceAccountReconciler(WithLogger(logr.Discard()), WithProxyCA(proxyCA))
+
+			raw, err := clientcmd.Write(*r.buildKubeconfig(proxy.URL, tt.token))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			diagnosis := &Diagnosis{}
+			r.diagnoseProxy(context.Background(), sa, raw, diagnosis)
+
+			if check := diagnosis.Checks[0]; check.Status != tt.status {
+				t.Fatalf("expected the status %s, got %s: %s", tt.status, check.Status, check.Message)
+			}
+		})
+	}
+}
+
+func TestDiagnoseFluxImpersonation(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "oil-system", Name: "gitops-reconciler"}}
+
+	fluxControllers, err := ParseFluxControllers(DefaultFluxControllers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := fluxImpersonatorName(sa.Name)
+
+	role := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Namespace: sa.Namespace, Name: name}, Rules: fluxImpersonatorRules(sa)}
+	roleBinding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Namespace: sa.Namespace, Name: name},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+		Subjects:   fluxControllers,
+	}
+
+	driftedRoleBinding := roleBinding.DeepCopy()
+	driftedRoleBinding.Subjects = fluxControllers[:1]
+
+	tests := []struct {
+		name        string
+		objs        []client.Object
+		role        CheckStatus
+		roleBinding CheckStatus
+	}{
+		{name: "granted", objs: []client.Object{role, roleBinding}, role: CheckPassed, roleBinding: CheckPassed},
+		{name: "missing", role: CheckFailed, roleBinding: CheckFailed},
+		{name: "subjects drifted", objs: []client.Object{role, driftedRoleBinding}, role: CheckPassed, roleBinding: CheckFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewServiceAccountReconciler(
+				WithClient(fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.objs...).Build()),
+				WithLogger(logr.Discard()),
+				WithFluxControllers(fluxControllers),
+			)
+
+			diagnosis := &Diagnosis{}
+			r.diagnoseFluxImpersonation(context.Background(), sa, diagnosis)
+
+			if check := diagnosis.Checks[0]; check.Status != tt.role {
+				t.Fatalf("expected the Role status %s, got %s: %s", tt.role, check.Status, check.Message)
+			}
+
+			if check := diagnosis.Checks[1]; check.Status != tt.roleBinding {
+				t.Fatalf("expected the RoleBinding status %s, got %s: %s", tt.roleBinding, check.Status, check.Message)
+			}
+		})
+	}
+}
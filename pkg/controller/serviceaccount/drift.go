@@ -0,0 +1,154 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/projectcapsule/capsule-addon-flux/pkg/metrics"
+)
+
+// GeneratedObjects returns the kinds of the typed objects generated for the ServiceAccounts, labelled after them, to be
+// watched for drift.
+func GeneratedObjects() []client.Object {
+	return []client.Object{
+		&corev1.Secret{},
+		&rbacv1.Role{},
+		&rbacv1.RoleBinding{},
+		&rbacv1.ClusterRole{},
+		&rbacv1.ClusterRoleBinding{},
+		&capsulev1beta2.TenantResource{},
+		&capsulev1beta2.GlobalTenantResource{},
+	}
+}
+
+// Correction reports the fields of a generated object that drifted from the desired state, and have been corrected.
+type Correction struct {
+	Kind      string
+	Namespace string
+	Name      string
+	Fields    []string
+}
+
+func (c Correction) String() string {
+	name := c.Name
+	if c.Namespace != "" {
+		name = fmt.Sprintf("%s/%s", c.Namespace, c.Name)
+	}
+
+	return fmt.Sprintf("%s %s: corrected %s", c.Kind, name, strings.Join(c.Fields, ", "))
+}
+
+// driftTracker collects the fields of an object differing from the desired state, before they are corrected.
+type driftTracker struct {
+	fields []string
+}
+
+// track records the field if the current value differs from the desired one.
+func (d *driftTracker) track(field string, current, desired interface{}) {
+	if !equality.Semantic.DeepEqual(current, desired) {
+		d.fields = append(d.fields, field)
+	}
+}
+
+// trackSubset records the field if the current value does not hold the desired one, as for the labels or the spec
+// fields applied, which the other managers can extend.
+func (d *driftTracker) trackSubset(field string, current, desired interface{}) {
+	if !holds(current, desired) {
+		d.fields = append(d.fields, field)
+	}
+}
+
+// trackSpec records the spec if the current one does not hold the fields of the desired one, as converted to their
+// serialized form: the fields defaulted by the API server are ignored.
+// The specs must be pointers to structs: if they cannot be converted, they are compared as a whole.
+func (d *driftTracker) trackSpec(current, desired interface{}) {
+	currentSpec, currentErr := runtime.DefaultUnstructuredConverter.ToUnstructured(current)
+	desiredSpec, desiredErr := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+
+	if currentErr != nil || desiredErr != nil {
+		d.track("spec", current, desired)
+
+		return
+	}
+
+	d.trackSubset("spec", currentSpec, desiredSpec)
+}
+
+// holds returns true if the current value holds the desired one: maps are compared by the desired keys only, and
+// lists element by element.
+func holds(current, desired interface{}) bool {
+	switch desired := desired.(type) {
+	case map[string]string:
+		current, _ := current.(map[string]string)
+
+		for k, v := range desired {
+			if value, ok := current[k]; !ok || value != v {
+				return false
+			}
+		}
+
+		return true
+	case map[string]interface{}:
+		current, _ := current.(map[string]interface{})
+
+		for k, v := range desired {
+			if !holds(current[k], v) {
+				return false
+			}
+		}
+
+		return true
+	case []interface{}:
+		current, _ := current.([]interface{})
+		if len(current) != len(desired) {
+			return false
+		}
+
+		for i := range desired {
+			if !holds(current[i], desired[i]) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return equality.Semantic.DeepEqual(current, desired)
+	}
+}
+
+// correction returns the Correction of the existing object, if any of its fields has drifted.
+func (d *driftTracker) correction(kind string, obj client.Object, exists bool) (Correction, bool) {
+	if !exists || len(d.fields) == 0 {
+		return Correction{}, false
+	}
+
+	return Correction{Kind: kind, Namespace: obj.GetNamespace(), Name: obj.GetName(), Fields: d.fields}, true
+}
+
+// recordCorrection logs the Correction of an object generated for the ServiceAccount, emitting an Event on the
+// ServiceAccount and counting it with the drift corrections metric.
+// In the dry-run mode, nothing is corrected: the changes are reported by the apply layer instead.
+func (r *ServiceAccountReconciler) recordCorrection(ctx context.Context, sa *corev1.ServiceAccount, correction Correction) {
+	if r.isDryRun(ctx) {
+		return
+	}
+
+	r.logger(ctx).Info("Corrected the drift of a generated object", "correction", correction.String())
+
+	metrics.DriftCorrections.WithLabelValues(correction.Kind).Inc()
+
+	if r.recorder != nil {
+		r.recorder.Event(sa, corev1.EventTypeWarning, DriftCorrectedReason, correction.String())
+	}
+}
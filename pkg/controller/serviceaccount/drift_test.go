@@ -0,0 +1,160 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"slices"
+	"testing"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	capsuleapi "github.com/projectcapsule/capsule/pkg/api"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestHolds(t *testing.T) {
+	tests := []struct {
+		name             string
+		current, desired interface{}
+		holds            bool
+	}{
+		{name: "equal scalars", current: "10m0s", desired: "10m0s", holds: true},
+		{name: "different scalars", current: "10m0s", desired: "1m0s"},
+		{name: "labels", current: map[string]string{"team": "oil", "env": "prod"}, desired: map[string]string{"team": "oil"}, holds: true},
+		{name: "missing label", current: map[string]string{"env": "prod"}, desired: map[string]string{"team": "oil"}},
+		{name: "different label", current: map[string]string{"team": "gas"}, desired: map[string]string{"team": "oil"}},
+		{name: "nil labels", desired: map[string]string{"team": "oil"}},
+		{
+			name:    "extra keys",
+			current: map[string]interface{}{"interval": "10m0s", "timeout": "5m0s"},
+			desired: map[string]interface{}{"interval": "10m0s"},
+			holds:   true,
+		},
+		{
+			name:    "missing key",
+			current: map[string]interface{}{"timeout": "5m0s"},
+			desired: map[string]interface{}{"interval": "10m0s"},
+		},
+		{
+			name:    "nested extra keys",
+			current: map[string]interface{}{"sourceRef": map[string]interface{}{"kind": "GitRepository", "name": "oil", "namespace": "oil-system"}},
+			desired: map[string]interface{}{"sourceRef": map[string]interface{}{"kind": "GitRepository", "name": "oil"}},
+			holds:   true,
+		},
+		{
+			name:    "nested different value",
+			current: map[string]interface{}{"sourceRef": map[string]interface{}{"kind": "OCIRepository", "name": "oil"}},
+			desired: map[string]interface{}{"sourceRef": map[string]interface{}{"kind": "GitRepository", "name": "oil"}},
+		},
+		{
+			name:    "list with extra keys",
+			current: []interface{}{map[string]interface{}{"name": "oil", "namespace": "oil-system"}},
+			desired: []interface{}{map[string]interface{}{"name": "oil"}},
+			holds:   true,
+		},
+		{
+			name:    "longer list",
+			current: []interface{}{map[string]interface{}{"name": "oil"}, map[string]interface{}{"name": "gas"}},
+			desired: []interface{}{map[string]interface{}{"name": "oil"}},
+		},
+		{
+			name:    "shorter list",
+			current: []interface{}{},
+			desired: []interface{}{map[string]interface{}{"name": "oil"}},
+		},
+		{
+			name:    "reordered list",
+			current: []interface{}{"gas", "oil"},
+			desired: []interface{}{"oil", "gas"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if holds := holds(tt.current, tt.desired); holds != tt.holds {
+				t.Fatalf("expected the current value to hold the desired one %t, got %t", tt.holds, holds)
+			}
+		})
+	}
+}
+
+func TestTrackSubset(t *testing.T) {
+	drift := &driftTracker{}
+
+	drift.trackSubset("metadata.labels", map[string]string{"team": "oil", "env": "prod"}, map[string]string{"team": "oil"})
+	drift.trackSubset("metadata.annotations", map[string]string{}, map[string]string{ConfigHashAnnotationKey: "current"})
+
+	if fields := []string{"metadata.annotations"}; !slices.Equal(drift.fields, fields) {
+		t.Fatalf("expected the drifted fields %v, got %v", fields, drift.fields)
+	}
+}
+
+func TestTrackSpec(t *testing.T) {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "gitops-reconciler", Namespace: "oil-system"}}
+
+	tests := []struct {
+		name    string
+		current func(spec *capsulev1beta2.GlobalTenantResourceSpec)
+		drifted bool
+	}{
+		{name: "unchanged", current: func(*capsulev1beta2.GlobalTenantResourceSpec) {}},
+		{
+			name: "defaulted by the server",
+			current: func(spec *capsulev1beta2.GlobalTenantResourceSpec) {
+				spec.Resources[0].AdditionalMetadata = &capsuleapi.AdditionalMetadataSpec{}
+			},
+		},
+		{
+			name: "changed resync period",
+			current: func(spec *capsulev1beta2.GlobalTenantResourceSpec) {
+				spec.ResyncPeriod = metav1.Duration{Duration: TenantResourceResyncPeriod * 2}
+			},
+			drifted: true,
+		},
+		{
+			name: "changed pruning",
+			current: func(spec *capsulev1beta2.GlobalTenantResourceSpec) {
+				pruningOnDelete := false
+				spec.PruningOnDelete = &pruningOnDelete
+			},
+			drifted: true,
+		},
+		{
+			name: "changed tenant selector",
+			current: func(spec *capsulev1beta2.GlobalTenantResourceSpec) {
+				spec.TenantSelector.MatchLabels = map[string]string{corev1.LabelMetadataName: "gas"}
+			},
+			drifted: true,
+		},
+		{
+			name: "added resource",
+			current: func(spec *capsulev1beta2.GlobalTenantResourceSpec) {
+				spec.Resources = append(spec.Resources, capsulev1beta2.ResourceSpec{})
+			},
+			drifted: true,
+		},
+		{
+			name: "removed namespaced item",
+			current: func(spec *capsulev1beta2.GlobalTenantResourceSpec) {
+				spec.Resources[0].NamespacedItems = nil
+			},
+			drifted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := desiredGlobalTenantResource(sa, "oil")
+			current := desired.DeepCopy()
+			tt.current(&current.Spec)
+
+			drift := &driftTracker{}
+			drift.trackSpec(&current.Spec, &desired.Spec)
+
+			if drifted := len(drift.fields) > 0; drifted != tt.drifted {
+				t.Fatalf("expected the spec to be drifted %t, got %v", tt.drifted, drift.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Change actions, as reported in the dry-run mode.
+const (
+	ChangeCreate = "create"
+	ChangeUpdate = "update"
+	ChangeDelete = "delete"
+)
+
+// Change reports a write the addon would perform in the dry-run mode, along with the fields it would change.
+type Change struct {
+	Action    string
+	Kind      string
+	Namespace string
+	Name      string
+	Fields    []string
+}
+
+func (c Change) String() string {
+	name := c.Name
+	if c.Namespace != "" {
+		name = fmt.Sprintf("%s/%s", c.Namespace, c.Name)
+	}
+
+	message := fmt.Sprintf("would %s %s %s", c.Action, c.Kind, name)
+	if len(c.Fields) > 0 {
+		message += ": " + strings.Join(c.Fields, ", ")
+	}
+
+	return message
+}
+
+type planKey struct{}
+
+// plan collects the objects the addon would delete during a dry-run reconciliation, so that the objects recreated,
+// such as the bindings with an immutable roleRef, are reported as created.
+// A collecting plan, as used to render the objects offline, collects the objects the addon would write too.
+type plan struct {
+	deleted sets.Set[string]
+	// collect enables the collection of the written objects, along with the dry-run mode.
+	collect bool
+	written []client.Object
+}
+
+// withPlan returns a context tracking the changes of the dry-run mode, keeping the plan already carried, if any.
+func withPlan(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(planKey{}).(*plan); ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, planKey{}, &plan{deleted: sets.New[string]()})
+}
+
+// withCollectingPlan returns a context carrying a collecting plan, returned too, enabling the dry-run mode for the
+// reconciliations performed with it.
+func withCollectingPlan(ctx context.Context) (context.Context, *plan) {
+	p := &plan{deleted: sets.New[string](), collect: true}
+
+	return context.WithValue(ctx, planKey{}, p), p
+}
+
+// isDryRun returns true if the dry-run mode is enabled, for the reconciler or by the plan carried by the context.
+func (r *ServiceAccountReconciler) isDryRun(ctx context.Context) bool {
+	p, ok := ctx.Value(planKey{}).(*plan)
+
+	return r.dryRun || ok && p.collect
+}
+
+// planWritten records the object the addon would write in the collecting plan carried by the context, if any,
+// replacing the one previously recorded with the same kind and key, returning true if recorded.
+func planWritten(ctx context.Context, gvk schema.GroupVersionKind, obj client.Object) bool {
+	p, ok := ctx.Value(planKey{}).(*plan)
+	if !ok || !p.collect {
+		return false
+	}
+
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+
+	for i, written := range p.written {
+		if written.GetObjectKind().GroupVersionKind() == gvk && client.ObjectKeyFromObject(written) == client.ObjectKeyFromObject(obj) {
+			p.written[i] = obj
+
+			return true
+		}
+	}
+
+	p.written = append(p.written, obj)
+
+	return true
+}
+
+// planDeleted records the deletion of the object of the kind specified in the plan carried by the context, if any.
+func planDeleted(ctx context.Context, gvk schema.GroupVersionKind, obj client.Object) {
+	if p, ok := ctx.Value(planKey{}).(*plan); ok {
+		p.deleted.Insert(gvk.Kind + "/" + client.ObjectKeyFromObject(obj).String())
+	}
+}
+
+// isPlannedDeleted returns true if the object of the kind specified would have been deleted.
+func isPlannedDeleted(ctx context.Context, gvk schema.GroupVersionKind, obj client.Object) bool {
+	p, ok := ctx.Value(planKey{}).(*plan)
+
+	return ok && p.deleted.Has(gvk.Kind+"/"+client.ObjectKeyFromObject(obj).String())
+}
+
+// planApply reports the changes the server-side apply of the object would perform, without persisting them: the
+// apply is sent as a dry-run request, and the resulting object compared with the current one.
+func (r *ServiceAccountReconciler) planApply(ctx context.Context, sa *corev1.ServiceAccount, gvk schema.GroupVersionKind, obj client.Object) error {
+	if planWritten(ctx, gvk, obj) {
+		return nil
+	}
+
+	current, err := r.newObject(gvk)
+	if err != nil {
+		return err
+	}
+
+	if err = r.Client.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+
+		r.recordChange(ctx, sa, obj, Change{Action: ChangeCreate, Kind: gvk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName()})
+
+		return nil
+	}
+
+	if isPlannedDeleted(ctx, gvk, obj) {
+		r.recordChange(ctx, sa, obj, Change{Action: ChangeCreate, Kind: gvk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName()})
+
+		return nil
+	}
+
+	if err = r.Client.Patch(ctx, obj, client.Apply, client.FieldOwner(FieldManager), client.ForceOwnership, client.DryRunAll); err != nil {
+		return err
+	}
+
+	fields, err := changedFields(current, obj)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) > 0 {
+		r.recordChange(ctx, sa, obj, Change{Action: ChangeUpdate, Kind: gvk.Kind, Namespace: obj.GetNamespace(), Name: obj.GetName(), Fields: fields})
+	}
+
+	return nil
+}
+
+// changedFields returns the top-level fields, and the metadata ones set by the addon, differing between the current
+// object and the applied one.
+func changedFields(current, applied client.Object) ([]string, error) {
+	currentContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(current)
+	if err != nil {
+		return nil, err
+	}
+
+	appliedContent, err := runtime.DefaultUnstructuredConverter.ToUnstructured(applied)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []string
+
+	for _, field := range sets.List(sets.KeySet(currentContent).Union(sets.KeySet(appliedContent))) {
+		switch field {
+		case "apiVersion", "kind", "metadata", "status":
+			continue
+		}
+
+		if !equality.Semantic.DeepEqual(currentContent[field], appliedContent[field]) {
+			fields = append(fields, field)
+		}
+	}
+
+	currentMetadata, _ := currentContent["metadata"].(map[string]interface{})
+	appliedMetadata, _ := appliedContent["metadata"].(map[string]interface{})
+
+	for _, field := range []string{"labels", "annotations", "ownerReferences", "finalizers"} {
+		if !equality.Semantic.DeepEqual(currentMetadata[field], appliedMetadata[field]) {
+			fields = append(fields, "metadata."+field)
+		}
+	}
+
+	sort.Strings(fields)
+
+	return fields, nil
+}
+
+// recordChange logs the Change the addon would perform in the dry-run mode, emitting an Event on the ServiceAccount,
+// if any, or on the object otherwise.
+func (r *ServiceAccountReconciler) recordChange(ctx context.Context, sa *corev1.ServiceAccount, obj client.Object, change Change) {
+	r.logger(ctx).Info("Dry-run: skipped a write", "change", change.String())
+
+	if r.recorder == nil {
+		return
+	}
+
+	var target runtime.Object = obj
+	if sa != nil {
+		target = sa
+	}
+
+	r.recorder.Event(target, corev1.EventTypeNormal, DryRunReason, change.String())
+}
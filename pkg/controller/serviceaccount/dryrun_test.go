@@ -0,0 +1,129 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestChangedFields(t *testing.T) {
+	newObject := func(metadata, spec map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "kustomize.toolkit.fluxcd.io/v1",
+			"kind":       "Kustomization",
+			"metadata":   metadata,
+		}}
+
+		if spec != nil {
+			obj.Object["spec"] = spec
+		}
+
+		return obj
+	}
+
+	spec := map[string]interface{}{
+		"interval":  "10m0s",
+		"sourceRef": map[string]interface{}{"kind": "GitRepository", "name": "gitops-reconciler"},
+		"kubeConfig": map[string]interface{}{
+			"secretRef": map[string]interface{}{"name": "gitops-reconciler-kubeconfig", "key": "kubeconfig"},
+		},
+	}
+	metadata := map[string]interface{}{
+		"name":      "gitops-reconciler",
+		"namespace": "oil-system",
+		"labels":    map[string]interface{}{LabelManagedBy: ManagerName},
+	}
+
+	tests := []struct {
+		name             string
+		current, applied *unstructured.Unstructured
+		fields           []string
+	}{
+		{
+			name:    "unchanged",
+			current: newObject(metadata, spec),
+			applied: newObject(metadata, spec),
+		},
+		{
+			name:    "nested map",
+			current: newObject(metadata, spec),
+			applied: newObject(metadata, map[string]interface{}{
+				"interval":  "10m0s",
+				"sourceRef": map[string]interface{}{"kind": "GitRepository", "name": "gitops-reconciler"},
+				"kubeConfig": map[string]interface{}{
+					"secretRef": map[string]interface{}{"name": "gitops-reconciler-kubeconfig", "key": "value"},
+				},
+			}),
+			fields: []string{"spec"},
+		},
+		{
+			name:    "removed field",
+			current: newObject(metadata, spec),
+			applied: newObject(metadata, nil),
+			fields:  []string{"spec"},
+		},
+		{
+			name:    "added field",
+			current: newObject(metadata, nil),
+			applied: newObject(metadata, spec),
+			fields:  []string{"spec"},
+		},
+		{
+			name: "metadata",
+			current: newObject(map[string]interface{}{
+				"name":        "gitops-reconciler",
+				"namespace":   "oil-system",
+				"labels":      map[string]interface{}{LabelManagedBy: ManagerName},
+				"annotations": map[string]interface{}{ConfigHashAnnotationKey: "previous"},
+			}, spec),
+			applied: newObject(map[string]interface{}{
+				"name":        "gitops-reconciler",
+				"namespace":   "oil-system",
+				"annotations": map[string]interface{}{ConfigHashAnnotationKey: "current"},
+				"finalizers":  []interface{}{"finalizers.fluxcd.io"},
+			}, spec),
+			fields: []string{"metadata.annotations", "metadata.finalizers", "metadata.labels"},
+		},
+		{
+			name: "ignored metadata and status",
+			current: newObject(map[string]interface{}{
+				"name":            "gitops-reconciler",
+				"namespace":       "oil-system",
+				"labels":          map[string]interface{}{LabelManagedBy: ManagerName},
+				"resourceVersion": "1",
+				"generation":      int64(1),
+				"managedFields":   []interface{}{map[string]interface{}{"manager": "kustomize-controller"}},
+			}, spec),
+			applied: func() *unstructured.Unstructured {
+				obj := newObject(map[string]interface{}{
+					"name":            "gitops-reconciler",
+					"namespace":       "oil-system",
+					"labels":          map[string]interface{}{LabelManagedBy: ManagerName},
+					"resourceVersion": "2",
+					"generation":      int64(2),
+					"managedFields":   []interface{}{map[string]interface{}{"manager": FieldManager}},
+				}, spec)
+				obj.Object["status"] = map[string]interface{}{"observedGeneration": int64(2)}
+
+				return obj
+			}(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := changedFields(tt.current, tt.applied)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !slices.Equal(fields, tt.fields) {
+				t.Fatalf("expected the changed fields %v, got %v", tt.fields, fields)
+			}
+		})
+	}
+}
@@ -9,4 +9,8 @@ var (
 	ErrServiceAccountTokenNotFound    = errors.New("service account token not found")
 	ErrGetServiceAccountToken         = errors.New("error getting service account token")
 	ErrServiceAccountTokenSecretEmpty = errors.New("the service account token secret is empty")
+	ErrServiceAccountNotTenantOwner   = errors.New("the service account is not a tenant owner")
+	ErrProxyVerificationFailed        = errors.New("the kubeconfig verification against the capsule proxy failed")
+	ErrConfigurationNotValidated      = errors.New("the addon configuration has not been validated yet")
+	ErrProxyURLNotAllowed             = errors.New("the capsule proxy url is not allowed by the addon configuration")
 )
@@ -5,46 +5,100 @@ package serviceaccount
 
 import (
 	"context"
+	"fmt"
 
 	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
-// ensureGlobalTenantResource ensures the GlobalTenantResource to distribute an object.
-func (r *ServiceAccountReconciler) ensureGlobalTenantResource(ctx context.Context, name, tenantName string, object runtime.Object) error {
-	gtr := &capsulev1beta2.GlobalTenantResource{
+// ensureGlobalTenantResource ensures the GlobalTenantResource to distribute the kubeConfig Secret of the
+// ServiceAccount to the Tenant specified.
+// The Secret is referenced by selector, in order to keep the credentials only in Secrets.
+func (r *ServiceAccountReconciler) ensureGlobalTenantResource(ctx context.Context, sa *corev1.ServiceAccount, tenantName string) error {
+	gtr := desiredGlobalTenantResource(sa, tenantName)
+
+	return r.ensure(ctx, sa, gtr, func(current client.Object, drift *driftTracker) {
+		drift.trackSpec(&current.(*capsulev1beta2.GlobalTenantResource).Spec, &gtr.Spec) //nolint:forcetypeassert
+	})
+}
+
+// desiredGlobalTenantResource returns the desired GlobalTenantResource distributing the kubeConfig Secret of the
+// ServiceAccount to the Tenant specified.
+func desiredGlobalTenantResource(sa *corev1.ServiceAccount, tenantName string) *capsulev1beta2.GlobalTenantResource {
+	return &capsulev1beta2.GlobalTenantResource{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   name,
-			Labels: map[string]string{"app.kubernetes.io/managed-by": ManagerName},
+			Name:   globalTenantResourceName(sa, tenantName),
+			Labels: globalTenantResourceLabels(sa, tenantName),
 		},
 		Spec: capsulev1beta2.GlobalTenantResourceSpec{
 			TenantSelector: metav1.LabelSelector{
-				MatchLabels: map[string]string{"kubernetes.io/metadata.name": tenantName},
-			},
-			TenantResourceSpec: capsulev1beta2.TenantResourceSpec{
-				Resources: []capsulev1beta2.ResourceSpec{{
-					RawItems: []capsulev1beta2.RawExtension{{
-						RawExtension: runtime.RawExtension{
-							Object: object,
-						},
-					}},
-				}},
+				MatchLabels: map[string]string{corev1.LabelMetadataName: tenantName},
 			},
+			TenantResourceSpec: kubeconfigTenantResourceSpec(sa),
 		},
 	}
+}
 
-	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, gtr, func() error {
-		if gtr.Labels == nil {
-			gtr.Labels = make(map[string]string, 1)
-		}
-		gtr.Labels["app.kubernetes.io/managed-by"] = ManagerName
+// deleteGlobalTenantResource deletes, if present and managed by the addon, the GlobalTenantResource of which the name
+// is specified as argument.
+func (r *ServiceAccountReconciler) deleteGlobalTenantResource(ctx context.Context, name string) error {
+	gtr := new(capsulev1beta2.GlobalTenantResource)
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: name}, gtr); err != nil {
+		return client.IgnoreNotFound(err)
+	}
 
+	if gtr.GetLabels()[LabelManagedBy] != ManagerName {
 		return nil
+	}
+
+	return r.delete(ctx, nil, gtr)
+}
+
+// deleteStaleGlobalTenantResources deletes the GlobalTenantResources generated for the ServiceAccount of which the
+// name and the namespace are specified as arguments, except the desired ones.
+func (r *ServiceAccountReconciler) deleteStaleGlobalTenantResources(ctx context.Context, saName, saNamespace string, desired sets.Set[string]) error {
+	gtrList := new(capsulev1beta2.GlobalTenantResourceList)
+	if err := r.Client.List(ctx, gtrList, client.MatchingLabels{
+		LabelManagedBy:               ManagerName,
+		LabelServiceAccountName:      saName,
+		LabelServiceAccountNamespace: saNamespace,
 	}); err != nil {
 		return err
 	}
 
+	for i := range gtrList.Items {
+		gtr := &gtrList.Items[i]
+		if desired.Has(gtr.Name) {
+			continue
+		}
+
+		r.logger(ctx).Info("Deleting stale GlobalTenantResource", "name", gtr.Name, "tenant", gtr.Labels[LabelTenant])
+
+		if err := r.delete(ctx, nil, gtr); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
+
+// globalTenantResourceName returns the name of the GlobalTenantResource distributing the kubeConfig of the
+// ServiceAccount to the Tenant specified.
+func globalTenantResourceName(sa *corev1.ServiceAccount, tenantName string) string {
+	return fmt.Sprintf("%s-%s%s", tenantName, sa.Name, GlobalTenantResourceSuffix)
+}
+
+// globalTenantResourceLabels returns the labels identifying the GlobalTenantResource generated for the
+// ServiceAccount and the Tenant specified.
+func globalTenantResourceLabels(sa *corev1.ServiceAccount, tenantName string) map[string]string {
+	return map[string]string{
+		LabelManagedBy:               ManagerName,
+		LabelServiceAccountName:      sa.Name,
+		LabelServiceAccountNamespace: sa.Namespace,
+		LabelTenant:                  tenantName,
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+)
+
+// serviceAccountForObject maps an object generated by the addon to the ServiceAccount it originates from.
+func (r *ServiceAccountReconciler) serviceAccountForObject(_ context.Context, object client.Object) []reconcile.Request {
+	labels := object.GetLabels()
+
+	if labels[LabelManagedBy] != ManagerName || labels[LabelServiceAccountName] == "" || labels[LabelServiceAccountNamespace] == "" {
+		return nil
+	}
+
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{
+			Namespace: labels[LabelServiceAccountNamespace],
+			Name:      labels[LabelServiceAccountName],
+		},
+	}}
+}
+
+// serviceAccountsForTenant maps a Tenant to both the enabled ServiceAccounts it refers to, as owners or subjects of
+// additional RoleBindings, and the ServiceAccounts for which GlobalTenantResources targeting it have been generated,
+// in order to catch ownership changes.
+func (r *ServiceAccountReconciler) serviceAccountsForTenant(ctx context.Context, object client.Object) []reconcile.Request {
+	tnt, ok := object.(*capsulev1beta2.Tenant)
+	if !ok {
+		return nil
+	}
+
+	requests := make(map[types.NamespacedName]struct{})
+
+	groups := sets.New[string]()
+
+	addSubject := func(kind, name, namespace string) {
+		switch kind {
+		case capsulev1beta2.ServiceAccountOwner.String(), capsulev1beta2.UserOwner.String():
+			if ns, n, ok := parseServiceAccountUsername(name); ok {
+				requests[types.NamespacedName{Namespace: ns, Name: n}] = struct{}{}
+			} else if kind == rbacv1.ServiceAccountKind && namespace != "" {
+				requests[types.NamespacedName{Namespace: namespace, Name: name}] = struct{}{}
+			}
+		case capsulev1beta2.GroupOwner.String():
+			groups.Insert(name)
+		}
+	}
+
+	for _, owner := range tnt.Spec.Owners {
+		addSubject(owner.Kind.String(), owner.Name, "")
+	}
+
+	for _, binding := range tnt.Spec.AdditionalRoleBindings {
+		for _, subject := range binding.Subjects {
+			addSubject(subject.Kind, subject.Name, subject.Namespace)
+		}
+	}
+
+	if groups.Len() > 0 {
+		saList := new(corev1.ServiceAccountList)
+		if err := r.Client.List(ctx, saList); err != nil {
+			r.logger(ctx).Error(err, "Error listing ServiceAccounts for Tenant", "tenant", tnt.Name)
+		}
+
+		for _, sa := range saList.Items {
+			if !IsAddonEnabled(&sa) {
+				continue
+			}
+
+			identity := Identity{Namespace: sa.Namespace, Name: sa.Name, Groups: r.ownerGroups(sa.Namespace, sa.Name)}
+
+			for group := range groups {
+				if identity.matchesSubject(capsulev1beta2.GroupOwner.String(), group) {
+					requests[types.NamespacedName{Namespace: sa.Namespace, Name: sa.Name}] = struct{}{}
+
+					break
+				}
+			}
+		}
+	}
+
+	gtrList := new(capsulev1beta2.GlobalTenantResourceList)
+	if err := r.Client.List(ctx, gtrList, client.MatchingLabels{LabelManagedBy: ManagerName, LabelTenant: tnt.Name}); err != nil {
+		r.logger(ctx).Error(err, "Error listing GlobalTenantResources for Tenant", "tenant", tnt.Name)
+	}
+
+	for i := range gtrList.Items {
+		for _, request := range r.serviceAccountForObject(ctx, &gtrList.Items[i]) {
+			requests[request.NamespacedName] = struct{}{}
+		}
+	}
+
+	out := make([]reconcile.Request, 0, len(requests))
+	for nn := range requests {
+		out = append(out, reconcile.Request{NamespacedName: nn})
+	}
+
+	return out
+}
+
+// serviceAccountForCredential maps a FluxTenantCredential to the ServiceAccount it refers to, in order to hand the
+// ServiceAccount back to the annotations, or to garbage collect its resources, once the credential is deleted.
+func (r *ServiceAccountReconciler) serviceAccountForCredential(_ context.Context, object client.Object) []reconcile.Request {
+	ftc, ok := object.(*v1alpha1.FluxTenantCredential)
+	if !ok {
+		return nil
+	}
+
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{Namespace: ftc.Namespace, Name: ftc.Spec.ServiceAccountName},
+	}}
+}
+
+// serviceAccountsForConfiguration maps the AddonConfiguration in use to all the enabled ServiceAccounts, in order to
+// apply the updated platform defaults.
+func (r *ServiceAccountReconciler) serviceAccountsForConfiguration(ctx context.Context, object client.Object) []reconcile.Request {
+	if object.GetName() != r.configurationName {
+		return nil
+	}
+
+	saList := new(corev1.ServiceAccountList)
+	if err := r.Client.List(ctx, saList); err != nil {
+		r.logger(ctx).Error(err, "Error listing ServiceAccounts for AddonConfiguration", "configuration", object.GetName())
+
+		return nil
+	}
+
+	var requests []reconcile.Request
+
+	for _, sa := range saList.Items {
+		if IsAddonEnabled(&sa) {
+			requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: sa.Namespace, Name: sa.Name}})
+		}
+	}
+
+	return requests
+}
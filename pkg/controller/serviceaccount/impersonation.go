@@ -0,0 +1,156 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// DefaultFluxControllers are the ServiceAccounts of the Flux controllers reconciling the Kustomizations and the
+// HelmReleases, in the namespace/name form.
+var DefaultFluxControllers = []string{"flux-system/kustomize-controller", "flux-system/helm-controller"}
+
+// ensureFluxImpersonation ensures the Role and the RoleBinding, placed in the ServiceAccount Namespace, granting the
+// Flux controllers the impersonation of the ServiceAccount, as set with the serviceAccountName of the Flux objects.
+// The impersonation of a ServiceAccount is authorized on the serviceaccounts resource of its Namespace.
+// Only the bootstrapped Kustomization is set by the addon: the Flux objects authored by the Tenant must set the
+// serviceAccountName themselves, or rely on the --default-service-account flag of the Flux controllers.
+func (r *ServiceAccountReconciler) ensureFluxImpersonation(ctx context.Context, sa *corev1.ServiceAccount) error {
+	if len(r.fluxControllers) == 0 {
+		return errors.New("no Flux controllers configured for the impersonation")
+	}
+
+	name := fluxImpersonatorName(sa.Name)
+	rules := fluxImpersonatorRules(sa)
+
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: sa.Namespace,
+			Labels:    impersonationLabels(nil, sa),
+		},
+		Rules: rules,
+	}
+
+	if err := controllerutil.SetControllerReference(sa, role, r.Client.Scheme()); err != nil {
+		return err
+	}
+
+	if err := r.ensure(ctx, sa, role, func(current client.Object, drift *driftTracker) {
+		drift.track("rules", current.(*rbacv1.Role).Rules, rules) //nolint:forcetypeassert
+	}); err != nil {
+		return err
+	}
+
+	roleBinding := &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: sa.Namespace,
+			Labels:    impersonationLabels(nil, sa),
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     name,
+		},
+		Subjects: r.fluxControllers,
+	}
+
+	if err := controllerutil.SetControllerReference(sa, roleBinding, r.Client.Scheme()); err != nil {
+		return err
+	}
+
+	deleted, err := r.deleteRoleBindingWithStaleRoleRef(ctx, sa, roleBinding)
+	if err != nil {
+		return err
+	}
+
+	if deleted {
+		r.recordCorrection(ctx, sa, Correction{Kind: "RoleBinding", Namespace: sa.Namespace, Name: name, Fields: []string{"roleRef"}})
+	}
+
+	return r.ensure(ctx, sa, roleBinding, func(current client.Object, drift *driftTracker) {
+		drift.track("subjects", current.(*rbacv1.RoleBinding).Subjects, r.fluxControllers) //nolint:forcetypeassert
+	})
+}
+
+// fluxImpersonatorName returns the name of the Role, and RoleBinding, granting the Flux controllers the impersonation
+// of the ServiceAccount of which the name is specified.
+func fluxImpersonatorName(saName string) string {
+	return fmt.Sprintf("%s%s", saName, FluxImpersonatorSuffix)
+}
+
+// fluxImpersonatorRules returns the rules granting the impersonation of the ServiceAccount.
+func fluxImpersonatorRules(sa *corev1.ServiceAccount) []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{{
+		APIGroups:     []string{""},
+		Verbs:         []string{"impersonate"},
+		Resources:     []string{"serviceaccounts"},
+		ResourceNames: []string{sa.Name},
+	}}
+}
+
+// deleteFluxImpersonation deletes, if present and managed by the addon, the Role and the RoleBinding granting the Flux
+// controllers the impersonation of the ServiceAccount of which the name and the namespace are specified as arguments.
+func (r *ServiceAccountReconciler) deleteFluxImpersonation(ctx context.Context, saName, saNamespace string) error {
+	key := types.NamespacedName{Namespace: saNamespace, Name: fluxImpersonatorName(saName)}
+
+	for _, obj := range []client.Object{&rbacv1.RoleBinding{}, &rbacv1.Role{}} {
+		if err := r.Client.Get(ctx, key, obj); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if obj.GetLabels()[LabelManagedBy] != ManagerName {
+			continue
+		}
+
+		if err := r.delete(ctx, nil, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// impersonationLabels returns the labels of the impersonation objects, on top of the existing ones.
+func impersonationLabels(labels map[string]string, sa *corev1.ServiceAccount) map[string]string {
+	labels = bootstrapLabels(labels, sa)
+	labels[LabelComponent] = ComponentImpersonation
+
+	return labels
+}
+
+// ParseFluxControllers returns the ServiceAccount subjects of the Flux controllers specified in the namespace/name form.
+func ParseFluxControllers(controllers []string) ([]rbacv1.Subject, error) {
+	subjects := make([]rbacv1.Subject, 0, len(controllers))
+
+	for _, controller := range controllers {
+		namespace, name, ok := strings.Cut(controller, "/")
+		if !ok || namespace == "" || name == "" {
+			return nil, errors.Errorf("invalid Flux controller %q, expected the namespace/name form", controller)
+		}
+
+		subjects = append(subjects, rbacv1.Subject{
+			Kind:      rbacv1.ServiceAccountKind,
+			Namespace: namespace,
+			Name:      name,
+		})
+	}
+
+	return subjects, nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	"github.com/projectcapsule/capsule-addon-flux/pkg/indexer"
+)
+
+// ServiceAccountField indexes the generated objects by the ServiceAccount they originate from, in the namespace/name
+// form.
+const ServiceAccountField = ".metadata.serviceAccount"
+
+// GeneratedServiceAccount indexes the generated objects of a kind by the ServiceAccountField.
+type GeneratedServiceAccount struct {
+	obj client.Object
+}
+
+func (g GeneratedServiceAccount) Object() client.Object {
+	return g.obj
+}
+
+func (GeneratedServiceAccount) Field() string {
+	return ServiceAccountField
+}
+
+func (GeneratedServiceAccount) Func() client.IndexerFunc {
+	return func(object client.Object) []string {
+		labels := object.GetLabels()
+
+		if labels[LabelManagedBy] != ManagerName || labels[LabelServiceAccountName] == "" || labels[LabelServiceAccountNamespace] == "" {
+			return nil
+		}
+
+		return []string{serviceAccountKey(labels[LabelServiceAccountNamespace], labels[LabelServiceAccountName])}
+	}
+}
+
+// Indexers returns the indexers of all the kinds of the objects generated for the ServiceAccounts.
+func (r *ServiceAccountReconciler) Indexers() []indexer.CustomIndexer {
+	objs := GeneratedObjects()
+
+	for _, gvk := range append(r.BootstrapGroupVersionKinds(), r.NotificationGroupVersionKinds()...) {
+		obj := new(unstructured.Unstructured)
+		obj.SetGroupVersionKind(gvk)
+
+		objs = append(objs, obj)
+	}
+
+	indexers := make([]indexer.CustomIndexer, 0, len(objs))
+	for _, obj := range objs {
+		indexers = append(indexers, GeneratedServiceAccount{obj: obj})
+	}
+
+	return indexers
+}
+
+// Generated returns all the objects generated for the ServiceAccount of which the namespace and the name are specified
+// as arguments, relying on the ServiceAccountField indexers.
+// The labels the field is indexed from are selected too, for the clients listing from the API server rather than the
+// cache, which does not know the field.
+func (r *ServiceAccountReconciler) Generated(ctx context.Context, saNamespace, saName string) ([]client.Object, error) {
+	return r.listGenerated(ctx, client.MatchingFields{ServiceAccountField: serviceAccountKey(saNamespace, saName)}, client.MatchingLabels{
+		LabelManagedBy:               ManagerName,
+		LabelServiceAccountName:      saName,
+		LabelServiceAccountNamespace: saNamespace,
+	})
+}
+
+// Managed returns all the objects generated by the addon, identified by its labels, matching the additional labels
+// specified, if any.
+func (r *ServiceAccountReconciler) Managed(ctx context.Context, labels map[string]string) ([]client.Object, error) {
+	selector := client.MatchingLabels{LabelManagedBy: ManagerName}
+	for k, v := range labels {
+		selector[k] = v
+	}
+
+	return r.listGenerated(ctx, selector)
+}
+
+// listGenerated lists the objects of all the generated kinds matching the options specified.
+func (r *ServiceAccountReconciler) listGenerated(ctx context.Context, opts ...client.ListOption) ([]client.Object, error) {
+	var generated []client.Object
+
+	for _, idx := range r.Indexers() {
+		gvk, err := apiutil.GVKForObject(idx.Object(), r.Client.Scheme())
+		if err != nil {
+			return nil, err
+		}
+
+		list, err := r.newList(gvk)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = r.Client.List(ctx, list, opts...); err != nil {
+			return nil, errors.Wrapf(err, "error listing the generated %s", strings.ToLower(gvk.Kind))
+		}
+
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range items {
+			obj, ok := item.(client.Object)
+			if !ok {
+				continue
+			}
+			// The kind of the typed items is not set by the client.
+			obj.GetObjectKind().SetGroupVersionKind(gvk)
+
+			generated = append(generated, obj)
+		}
+	}
+
+	return generated, nil
+}
+
+// newList returns an empty list of the kind specified, unstructured if not registered in the scheme.
+func (r *ServiceAccountReconciler) newList(gvk schema.GroupVersionKind) (client.ObjectList, error) {
+	listGVK := gvk.GroupVersion().WithKind(gvk.Kind + "List")
+
+	if !r.Client.Scheme().Recognizes(listGVK) {
+		list := new(unstructured.UnstructuredList)
+		list.SetGroupVersionKind(listGVK)
+
+		return list, nil
+	}
+
+	obj, err := r.Client.Scheme().New(listGVK)
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := obj.(client.ObjectList)
+	if !ok {
+		return nil, errors.Errorf("unexpected list kind %s", listGVK.Kind)
+	}
+
+	return list, nil
+}
+
+// serviceAccountKey returns the key of the ServiceAccountField of the ServiceAccount.
+func serviceAccountKey(namespace, name string) string {
+	return namespace + "/" + name
+}
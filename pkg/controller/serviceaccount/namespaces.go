@@ -8,20 +8,22 @@ import (
 
 	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-// Set the Tenant owner reference on the Namespace specified.
-func (r *ServiceAccountReconciler) setNamespaceOwnerRef(ctx context.Context, ns *corev1.Namespace, tnt *capsulev1beta2.Tenant) error {
-	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, ns, func() error {
-		if err := controllerutil.SetControllerReference(tnt, ns, r.Client.Scheme()); err != nil {
-			return err
-		}
+// Set the Tenant owner reference on the Namespace specified, applying only the owner reference: the other fields,
+// such as the labels set by Capsule, are left to their managers.
+func (r *ServiceAccountReconciler) setNamespaceOwnerRef(ctx context.Context, sa *corev1.ServiceAccount, ns *corev1.Namespace, tnt *capsulev1beta2.Tenant) error {
+	desired := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: ns.Name,
+		},
+	}
 
-		return nil
-	}); err != nil {
+	if err := controllerutil.SetControllerReference(tnt, desired, r.Client.Scheme()); err != nil {
 		return err
 	}
 
-	return nil
+	return r.apply(ctx, sa, desired)
 }
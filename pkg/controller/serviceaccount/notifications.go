@@ -0,0 +1,156 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	ProviderGroupVersionKind = schema.GroupVersionKind{Group: "notification.toolkit.fluxcd.io", Version: "v1beta3", Kind: "Provider"}
+	AlertGroupVersionKind    = schema.GroupVersionKind{Group: "notification.toolkit.fluxcd.io", Version: "v1beta3", Kind: "Alert"}
+)
+
+// NotificationTemplate is the template of the Notification of the ServiceAccounts placed in the Namespaces of a Tenant.
+type NotificationTemplate struct {
+	// ProviderType is the type of the Flux notification Provider.
+	ProviderType string
+	// EventSeverity is the severity of the events notified.
+	EventSeverity string
+	// AddressAnnotation is the annotation of the Tenant holding the address of the Provider.
+	AddressAnnotation string
+}
+
+// Notification is the Flux notification Provider of the failures of the Kustomizations in a ServiceAccount Namespace.
+type Notification struct {
+	ProviderType  string
+	Address       string
+	EventSeverity string
+}
+
+// render returns the Notification of the Tenant, nil if the Tenant does not set the address.
+func (t NotificationTemplate) render(tnt *capsulev1beta2.Tenant) *Notification {
+	address := tnt.GetAnnotations()[t.AddressAnnotation]
+	if address == "" {
+		return nil
+	}
+
+	return &Notification{
+		ProviderType:  t.ProviderType,
+		Address:       address,
+		EventSeverity: t.EventSeverity,
+	}
+}
+
+// DetectNotifications returns true if the Flux notification Provider and Alert APIs are installed.
+func DetectNotifications(mapper meta.RESTMapper) bool {
+	for _, gvk := range []schema.GroupVersionKind{ProviderGroupVersionKind, AlertGroupVersionKind} {
+		if _, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// NotificationGroupVersionKinds returns the kinds of the notification objects generated, with the Provider first.
+func (r *ServiceAccountReconciler) NotificationGroupVersionKinds() []schema.GroupVersionKind {
+	if !r.notifications {
+		return nil
+	}
+
+	return []schema.GroupVersionKind{ProviderGroupVersionKind, AlertGroupVersionKind}
+}
+
+// ensureNotification ensures the Flux notification Provider and Alert of the ServiceAccount, named after it, notifying
+// the failures of the Kustomizations in its Namespace.
+func (r *ServiceAccountReconciler) ensureNotification(ctx context.Context, sa *corev1.ServiceAccount, settings Settings) error {
+	if !r.notifications {
+		r.logger(ctx).Info("Flux notification Provider and Alert APIs are not installed, skipping the notification")
+
+		return nil
+	}
+
+	provider := serviceAccountObject(ProviderGroupVersionKind, sa)
+	provider.SetLabels(notificationLabels(nil, sa))
+
+	if err := mergeSpec(provider, map[string]interface{}{
+		"type":    settings.Notification.ProviderType,
+		"address": settings.Notification.Address,
+	}); err != nil {
+		return err
+	}
+
+	if err := r.ensureUnstructured(ctx, sa, provider); err != nil {
+		return errors.Wrap(err, "error ensuring the notification provider")
+	}
+
+	alert := serviceAccountObject(AlertGroupVersionKind, sa)
+	alert.SetLabels(notificationLabels(nil, sa))
+
+	if err := mergeSpec(alert, map[string]interface{}{
+		"providerRef":   map[string]interface{}{"name": provider.GetName()},
+		"eventSeverity": settings.Notification.EventSeverity,
+		"eventSources": []interface{}{
+			map[string]interface{}{
+				"kind": KustomizationGroupVersionKind.Kind,
+				"name": "*",
+			},
+		},
+	}); err != nil {
+		return err
+	}
+
+	if err := r.ensureUnstructured(ctx, sa, alert); err != nil {
+		return errors.Wrap(err, "error ensuring the notification alert")
+	}
+
+	return nil
+}
+
+// deleteNotification deletes, if present and managed by the addon, the Flux notification Provider and Alert of the
+// ServiceAccount of which the name and the namespace are specified as arguments.
+func (r *ServiceAccountReconciler) deleteNotification(ctx context.Context, saName, saNamespace string) error {
+	gvks := r.NotificationGroupVersionKinds()
+
+	for i := len(gvks) - 1; i >= 0; i-- {
+		obj := new(unstructured.Unstructured)
+		obj.SetGroupVersionKind(gvks[i])
+
+		if err := r.Client.Get(ctx, types.NamespacedName{Namespace: saNamespace, Name: saName}, obj); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if obj.GetLabels()[LabelManagedBy] != ManagerName || obj.GetLabels()[LabelComponent] != ComponentNotification {
+			continue
+		}
+
+		if err := r.delete(ctx, nil, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// notificationLabels returns the labels of the notification objects, on top of the existing ones.
+func notificationLabels(labels map[string]string, sa *corev1.ServiceAccount) map[string]string {
+	labels = bootstrapLabels(labels, sa)
+	labels[LabelComponent] = ComponentNotification
+
+	return labels
+}
@@ -0,0 +1,78 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/projectcapsule/capsule-addon-flux/pkg/version"
+)
+
+// configHashLength is the length of the hash of the Settings set on the generated objects.
+const configHashLength = 16
+
+// origin is the origin of the objects generated while issuing a credential: the Tenant of the ServiceAccount Namespace,
+// and the hash of the Settings the credential is issued with.
+type origin struct {
+	tenant     string
+	configHash string
+}
+
+type originKey struct{}
+
+// withOrigin returns the context of the issuance of a credential, carrying the origin of the generated objects.
+func withOrigin(ctx context.Context, o origin) context.Context {
+	return context.WithValue(ctx, originKey{}, o)
+}
+
+// setOriginMetadata sets on the generated object the labels and the annotations tying it back to its origin: the
+// Tenant label, unless already set as for the GlobalTenantResources, the addon version and the configuration hash,
+// along with the build information of the addon on the Secrets.
+func setOriginMetadata(ctx context.Context, obj client.Object) {
+	o, ok := ctx.Value(originKey{}).(origin)
+	if !ok {
+		return
+	}
+
+	labels := obj.GetLabels()
+	if _, found := labels[LabelTenant]; !found && o.tenant != "" {
+		if labels == nil {
+			labels = make(map[string]string, 1)
+		}
+
+		labels[LabelTenant] = o.tenant
+		obj.SetLabels(labels)
+	}
+
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string, 2)
+	}
+
+	annotations[AddonVersionAnnotationKey] = version.Version
+	annotations[ConfigHashAnnotationKey] = o.configHash
+
+	if _, isSecret := obj.(*corev1.Secret); isSecret {
+		annotations[AddonBuildAnnotationKey] = version.Get().String()
+	}
+	obj.SetAnnotations(annotations)
+}
+
+// ConfigHash returns the hash of the Settings, identifying the configuration the objects have been generated with.
+func ConfigHash(settings Settings) string {
+	raw, err := json.Marshal(settings)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(raw)
+
+	return hex.EncodeToString(sum[:])[:configHashLength]
+}
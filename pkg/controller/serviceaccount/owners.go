@@ -0,0 +1,63 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// listServiceAccountTenants returns the Tenants owned by the ServiceAccount of which the namespace and the name are
+// specified as arguments, as resolved by the configured TenantResolvers.
+// Tenants are returned once, ordered by the resolvers order.
+func (r *ServiceAccountReconciler) listServiceAccountTenants(ctx context.Context, namespace, name string) (*capsulev1beta2.TenantList, error) {
+	identity := Identity{
+		Namespace: namespace,
+		Name:      name,
+		Groups:    r.ownerGroups(namespace, name),
+	}
+
+	out := &capsulev1beta2.TenantList{}
+	seen := sets.New[string]()
+
+	for _, resolver := range r.tenantResolvers {
+		tenants, err := resolver.Resolve(ctx, r.Client, identity)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error resolving Tenants with the %s resolver", resolver.Name())
+		}
+
+		for _, tnt := range tenants {
+			if seen.Has(tnt.Name) {
+				continue
+			}
+
+			seen.Insert(tnt.Name)
+			out.Items = append(out.Items, tnt)
+		}
+	}
+
+	return out, nil
+}
+
+// ownerGroups returns the Groups, rendered from the configured patterns, including the ServiceAccount of which the
+// namespace and the name are specified as arguments.
+func (r *ServiceAccountReconciler) ownerGroups(namespace, name string) []string {
+	groups := make([]string, 0, len(r.ownerGroupPatterns))
+
+	replacer := strings.NewReplacer(OwnerGroupPatternNamespace, namespace, OwnerGroupPatternName, name)
+
+	for _, pattern := range r.ownerGroupPatterns {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+
+		groups = append(groups, replacer.Replace(pattern))
+	}
+
+	return groups
+}
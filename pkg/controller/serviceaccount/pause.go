@@ -0,0 +1,53 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Paused returns the reason why the reconciliation of the ServiceAccount is paused, empty if not paused: the
+// reconciliation can be paused at manager-level, on the ServiceAccount, or on any of the Tenants it owns, with the
+// PausedAnnotationKey annotation.
+func (r *ServiceAccountReconciler) Paused(ctx context.Context, sa *corev1.ServiceAccount) (string, error) {
+	if r.paused {
+		return "Reconciliation is paused at manager-level", nil
+	}
+
+	if isPaused(sa) {
+		return fmt.Sprintf("Reconciliation is paused by the %s annotation on the ServiceAccount", PausedAnnotationKey), nil
+	}
+
+	tenantList, err := r.listServiceAccountTenants(ctx, sa.Namespace, sa.Name)
+	if err != nil {
+		return "", errors.Wrap(err, "error listing Tenants for owner")
+	}
+
+	for i := range tenantList.Items {
+		if isPaused(&tenantList.Items[i]) {
+			return fmt.Sprintf("Reconciliation is paused by the %s annotation on the Tenant %s", PausedAnnotationKey, tenantList.Items[i].Name), nil
+		}
+	}
+
+	return "", nil
+}
+
+// isPaused returns true if the object has the annotation pausing the reconciliation.
+func isPaused(object client.Object) bool {
+	return object.GetAnnotations()[PausedAnnotationKey] == PausedAnnotationValue
+}
+
+// recordPaused logs the pause of the reconciliation of the ServiceAccount, emitting an Event on it.
+func (r *ServiceAccountReconciler) recordPaused(ctx context.Context, sa *corev1.ServiceAccount, message string) {
+	r.logger(ctx).Info("Reconciliation is paused", "reason", message)
+
+	if r.recorder != nil {
+		r.recorder.Event(sa, corev1.EventTypeNormal, PausedReason, message)
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PlaceholderToken is the token set in the kubeConfig rendered offline, in place of a token issued for the
+// ServiceAccount.
+// #nosec G101
+const PlaceholderToken = "<token>"
+
+// Render returns the objects the addon would write for the ServiceAccount with the Settings specified, in the order
+// they are written: the RBAC, the Namespace owner reference, the token and kubeConfig Secrets, with the
+// PlaceholderToken, and the kubeConfig distribution, or the impersonation RBAC, along with the bootstrap and the
+// notification objects.
+// The objects are collected by running Issue in the dry-run mode, thus with the same decisions and desired-state
+// builders, without writing any object.
+// ErrServiceAccountNotTenantOwner is returned when the ServiceAccount does not own any of the Tenants.
+func (r *ServiceAccountReconciler) Render(ctx context.Context, sa *corev1.ServiceAccount, settings Settings) ([]client.Object, error) {
+	ctx, p := withCollectingPlan(ctx)
+
+	if _, err := r.Issue(ctx, sa, settings); err != nil {
+		return nil, err
+	}
+
+	return p.written, nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"github.com/projectcapsule/capsule/pkg/indexer/tenant"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/indexer"
+)
+
+// TestRender compares the objects rendered for a ServiceAccount with the ones Issue writes for it.
+func TestRender(t *testing.T) {
+	scheme := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{clientgoscheme.AddToScheme, capsulev1beta2.AddToScheme, v1alpha1.AddToScheme} {
+		if err := add(scheme); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tnt := &capsulev1beta2.Tenant{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "oil",
+			UID:         "oil",
+			Annotations: map[string]string{TenantNotificationAddressAnnotationKey: "https://hooks.slack.com/services/oil"},
+		},
+		Spec: capsulev1beta2.TenantSpec{
+			Owners: []capsulev1beta2.OwnerSpec{{Kind: capsulev1beta2.ServiceAccountOwner, Name: "system:serviceaccount:oil-system:gitops-reconciler"}},
+		},
+		Status: capsulev1beta2.TenantStatus{Namespaces: []string{"oil-dev", "oil-system"}},
+	}
+
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:            "oil-system",
+		OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(tnt, capsulev1beta2.GroupVersion.WithKind("Tenant"))},
+	}}
+
+	fluxControllers, err := ParseFluxControllers(DefaultFluxControllers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		annotations map[string]string
+	}{
+		{
+			name: "kubeConfig",
+		},
+		{
+			name:        "kubeConfig distributed with GlobalTenantResources",
+			annotations: map[string]string{ServiceAccountGlobalAnnotationKey: ServiceAccountGlobalAnnotationValue},
+		},
+		{
+			name: "kubeConfig distributed with a TenantResource",
+			annotations: map[string]string{
+				ServiceAccountGlobalAnnotationKey:       ServiceAccountGlobalAnnotationValue,
+				ServiceAccountDistributionAnnotationKey: DistributionTenantResource,
+			},
+		},
+		{
+			name:        "impersonation",
+			annotations: map[string]string{ServiceAccountModeAnnotationKey: ModeImpersonation},
+		},
+		{
+			name: "bootstrap",
+			annotations: map[string]string{
+				ServiceAccountBootstrapURLAnnotationKey:  "https://github.com/oil/gitops",
+				ServiceAccountBootstrapPathAnnotationKey: "./clusters/oil",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{
+				Namespace:   "oil-system",
+				Name:        "gitops-reconciler",
+				UID:         "gitops-reconciler",
+				Annotations: tt.annotations,
+			}}
+
+			newReconciler := func(funcs interceptor.Funcs) *ServiceAccountReconciler {
+				r := NewServiceAccountReconciler(
+					WithLogger(logr.Discard()),
+					WithProxyURL("https://capsule-proxy.capsule-system.svc:9001"),
+					WithTenantResolvers(OwnersTenantResolver{}),
+					WithBootstrapSources(BootstrapSourceGroupVersionKinds...),
+					WithNotifications(true),
+					WithFluxControllers(fluxControllers),
+				)
+
+				builder := fake.NewClientBuilder().WithScheme(scheme).
+					WithObjects(tnt.DeepCopy(), ns.DeepCopy(), sa.DeepCopy()).
+					WithInterceptorFuncs(funcs)
+				for _, idx := range append(r.Indexers(), tenant.OwnerReference{}, indexer.FluxTenantCredentialServiceAccount{}) {
+					builder = builder.WithIndex(idx.Object(), idx.Field(), idx.Func())
+				}
+
+				r.Client = builder.Build()
+
+				return r
+			}
+
+			renderer := newReconciler(interceptor.Funcs{})
+
+			settings, err := renderer.AnnotationSettings(context.Background(), sa)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			rendered, err := renderer.Render(context.Background(), sa, settings)
+			if err != nil {
+				t.Fatalf("unexpected error rendering: %v", err)
+			}
+
+			// The fake client does not support the server-side apply: the objects applied are created, or updated, and
+			// the token Secret is populated as by the token controller.
+			var written []client.Object
+
+			issuer := newReconciler(interceptor.Funcs{
+				Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+					if patch != client.Apply {
+						return c.Patch(ctx, obj, patch, opts...)
+					}
+
+					written = append(written, obj.DeepCopyObject().(client.Object)) //nolint:forcetypeassert
+
+					if secret, ok := obj.(*corev1.Secret); ok && secret.Type == corev1.SecretTypeServiceAccountToken {
+						secret.Data = map[string][]byte{corev1.ServiceAccountTokenKey: []byte("token")}
+					}
+
+					current := obj.DeepCopyObject().(client.Object) //nolint:forcetypeassert
+					if err := c.Get(ctx, client.ObjectKeyFromObject(obj), current); err != nil {
+						if !apierrors.IsNotFound(err) {
+							return err
+						}
+
+						return c.Create(ctx, obj)
+					}
+
+					obj.SetResourceVersion(current.GetResourceVersion())
+
+					return c.Update(ctx, obj)
+				},
+			})
+
+			if _, err = issuer.Issue(context.Background(), sa, settings); err != nil {
+				t.Fatalf("unexpected error issuing: %v", err)
+			}
+
+			if expected, got := objectKeys(t, scheme, written), objectKeys(t, scheme, rendered); !slices.Equal(expected, got) {
+				t.Fatalf("expected the objects %v, got %v", expected, got)
+			}
+
+			for i := range written {
+				if expected, got := written[i].GetLabels(), rendered[i].GetLabels(); fmt.Sprint(expected) != fmt.Sprint(got) {
+					t.Fatalf("expected the labels %v, got %v", expected, got)
+				}
+			}
+		})
+	}
+}
+
+// objectKeys returns the kinds and the keys of the objects.
+func objectKeys(t *testing.T, scheme *runtime.Scheme, objs []client.Object) []string {
+	t.Helper()
+
+	keys := make([]string, 0, len(objs))
+
+	for _, obj := range objs {
+		gvk, err := apiutil.GVKForObject(obj, scheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keys = append(keys, gvk.Kind+" "+client.ObjectKeyFromObject(obj).String())
+	}
+
+	return keys
+}
@@ -7,111 +7,315 @@ import (
 	"context"
 	"fmt"
 
+	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-func (r *ServiceAccountReconciler) ensureRoles(ctx context.Context, saName, saNamespace string) error {
-	subjects := []rbacv1.Subject{{Kind: "ServiceAccount", Name: saName, Namespace: saNamespace}}
+// roles are the RBAC objects generated for a ServiceAccount.
+type roles struct {
+	// binding binds the ServiceAccount to the ClusterRole specified, in its Namespace.
+	binding *rbacv1.RoleBinding
+	// clusterRole and clusterRoleBinding grant the impersonation of the cluster-wide identities of the ServiceAccount,
+	// such as its fully-qualified username and its groups.
+	clusterRole        *rbacv1.ClusterRole
+	clusterRoleBinding *rbacv1.ClusterRoleBinding
+	// role and roleBinding grant the impersonation of the ServiceAccount itself, which is scoped to its Namespace: nil
+	// when not requested.
+	role        *rbacv1.Role
+	roleBinding *rbacv1.RoleBinding
+}
+
+// desiredRoles returns the desired RBAC of the ServiceAccount: the RoleBinding to the ClusterRole in its Namespace,
+// the impersonator ClusterRole and ClusterRoleBinding, and the impersonator Role and RoleBinding, if requested.
+func (r *ServiceAccountReconciler) desiredRoles(sa *corev1.ServiceAccount, settings Settings) (roles, error) {
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: sa.Name, Namespace: sa.Namespace}}
+
+	// The Service Account Namespace RoleBinding, to cluster-admin by default.
+	out := roles{
+		binding: &rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      sa.Name,
+				Namespace: sa.Namespace,
+				Labels:    rbacLabels(nil, sa),
+			},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "ClusterRole",
+				Name:     settings.ClusterRoleName,
+			},
+			Subjects: subjects,
+		},
+	}
+
+	if err := controllerutil.SetControllerReference(sa, out.binding, r.Client.Scheme()); err != nil {
+		return roles{}, err
+	}
+
+	clusterRules, namespacedRules := impersonatorRules(sa, settings.ImpersonatorResources)
 
-	// Ensure the Service Account Namespace cluster-admin RoleBinding.
-	homeAdminRB := &rbacv1.RoleBinding{
+	// The Service Account impersonator ClusterRole, and its ClusterRoleBinding.
+	impersonatorName := impersonatorClusterRoleName(sa)
+
+	out.clusterRole = &rbacv1.ClusterRole{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      saName,
-			Namespace: saNamespace,
+			Name:   impersonatorName,
+			Labels: rbacLabels(nil, sa),
+		},
+		Rules: clusterRules,
+	}
+
+	out.clusterRoleBinding = &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   impersonatorName,
+			Labels: rbacLabels(nil, sa),
 		},
-		Subjects: subjects,
 		RoleRef: rbacv1.RoleRef{
-			APIGroup: "rbac.authorization.k8s.io",
+			APIGroup: rbacv1.GroupName,
 			Kind:     "ClusterRole",
-			Name:     "cluster-admin",
+			Name:     impersonatorName,
 		},
+		Subjects: subjects,
 	}
 
-	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, homeAdminRB, func() error {
-		if homeAdminRB.Subjects == nil {
-			homeAdminRB.Subjects = subjects
-		}
+	if len(namespacedRules) == 0 {
+		return out, nil
+	}
 
-		if homeAdminRB.RoleRef.Name != "cluster-admin" ||
-			homeAdminRB.RoleRef.Kind != "ClusterRole" ||
-			homeAdminRB.RoleRef.APIGroup != "rbac.authorization.k8s.io" {
-			homeAdminRB.RoleRef = rbacv1.RoleRef{
-				APIGroup: "rbac.authorization.k8s.io",
-				Kind:     "ClusterRole",
-				Name:     "cluster-admin",
-			}
+	// The Service Account impersonator Role, and its RoleBinding, placed in its Namespace.
+	impersonatorRoleName := impersonatorRoleName(sa)
+
+	out.role = &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      impersonatorRoleName,
+			Namespace: sa.Namespace,
+			Labels:    rbacLabels(nil, sa),
+		},
+		Rules: namespacedRules,
+	}
+
+	out.roleBinding = &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      impersonatorRoleName,
+			Namespace: sa.Namespace,
+			Labels:    rbacLabels(nil, sa),
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     impersonatorRoleName,
+		},
+		Subjects: subjects,
+	}
+
+	for _, obj := range []client.Object{out.role, out.roleBinding} {
+		if err := controllerutil.SetControllerReference(sa, obj, r.Client.Scheme()); err != nil {
+			return roles{}, err
 		}
+	}
 
-		return nil
+	return out, nil
+}
+
+// ensureRoles ensures the RBAC of the ServiceAccount: the RoleBinding to the ClusterRole in its Namespace, the
+// impersonator ClusterRole and ClusterRoleBinding, and the impersonator Role and RoleBinding, if requested.
+// Any drift of the generated objects is corrected, and recorded.
+func (r *ServiceAccountReconciler) ensureRoles(ctx context.Context, sa *corev1.ServiceAccount, settings Settings) error {
+	desired, err := r.desiredRoles(sa, settings)
+	if err != nil {
+		return err
+	}
+
+	// The RoleBinding roleRef is immutable: recreate the RoleBinding when the ClusterRole changes.
+	deleted, err := r.deleteRoleBindingWithStaleRoleRef(ctx, sa, desired.binding)
+	if err != nil {
+		return err
+	}
+
+	if deleted {
+		r.recordCorrection(ctx, sa, Correction{Kind: "RoleBinding", Namespace: sa.Namespace, Name: sa.Name, Fields: []string{"roleRef"}})
+	}
+
+	if err = r.ensure(ctx, sa, desired.binding, func(current client.Object, drift *driftTracker) {
+		drift.track("subjects", current.(*rbacv1.RoleBinding).Subjects, desired.binding.Subjects) //nolint:forcetypeassert
 	}); err != nil {
 		return err
 	}
 
-	// Ensure the Service Account impersonator ClusterRole.
-	impersonatorName := fmt.Sprintf("%s-%s-impersonator", saNamespace, saName)
+	// The aggregation would overwrite the rules: it is not applied, thus it must be removed explicitly.
+	if err = r.removeAggregationRule(ctx, sa, desired.clusterRole.Name); err != nil {
+		return err
+	}
 
-	impersonatorRules := []rbacv1.PolicyRule{{
-		APIGroups:     []string{""},
-		Verbs:         []string{"impersonate"},
-		Resources:     []string{"users"},
-		ResourceNames: []string{fmt.Sprintf("system:serviceaccount:%s:%s", saNamespace, saName)},
-	}}
+	if err = r.ensure(ctx, sa, desired.clusterRole, func(current client.Object, drift *driftTracker) {
+		drift.track("rules", current.(*rbacv1.ClusterRole).Rules, desired.clusterRole.Rules) //nolint:forcetypeassert
+	}); err != nil {
+		return err
+	}
 
-	impersonatorCR := &rbacv1.ClusterRole{
-		ObjectMeta: metav1.ObjectMeta{Name: impersonatorName},
-		Rules:      impersonatorRules,
+	// The ClusterRoleBinding roleRef is immutable too.
+	if deleted, err = r.deleteClusterRoleBindingWithStaleRoleRef(ctx, sa, desired.clusterRoleBinding); err != nil {
+		return err
 	}
 
-	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, impersonatorCR, func() error {
-		if len(impersonatorCR.Rules) == 0 {
-			impersonatorCR.Rules = impersonatorRules
-		}
-		if impersonatorCR.Rules[0].Verbs == nil {
-			impersonatorCR.Rules[0].Verbs = []string{"impersonate"}
-		}
-		if impersonatorCR.Rules[0].Resources == nil {
-			impersonatorCR.Rules[0].Resources = []string{"users"}
-		}
-		if impersonatorCR.Rules[0].ResourceNames == nil {
-			impersonatorCR.Rules[0].ResourceNames = []string{
-				fmt.Sprintf("system:serviceaccount:%s:%s", saNamespace, saName),
-			}
-		}
+	if deleted {
+		r.recordCorrection(ctx, sa, Correction{Kind: "ClusterRoleBinding", Name: desired.clusterRoleBinding.Name, Fields: []string{"roleRef"}})
+	}
 
-		return nil
+	if err = r.ensure(ctx, sa, desired.clusterRoleBinding, func(current client.Object, drift *driftTracker) {
+		drift.track("subjects", current.(*rbacv1.ClusterRoleBinding).Subjects, desired.clusterRoleBinding.Subjects) //nolint:forcetypeassert
 	}); err != nil {
 		return err
 	}
 
-	// Ensure the Service Account impersonator ClusterRoleBinding.
-	impersonatorRoleRef := rbacv1.RoleRef{
-		APIGroup: "rbac.authorization.k8s.io",
-		Kind:     "ClusterRole",
-		Name:     impersonatorName,
+	if desired.role == nil {
+		return r.deleteImpersonatorRole(ctx, sa)
 	}
 
-	impersonatorCRB := &rbacv1.ClusterRoleBinding{
-		ObjectMeta: metav1.ObjectMeta{Name: impersonatorName},
-		Subjects:   subjects,
-		RoleRef:    impersonatorRoleRef,
+	if err = r.ensure(ctx, sa, desired.role, func(current client.Object, drift *driftTracker) {
+		drift.track("rules", current.(*rbacv1.Role).Rules, desired.role.Rules) //nolint:forcetypeassert
+	}); err != nil {
+		return err
 	}
 
-	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, impersonatorCRB, func() error {
-		if impersonatorCRB.RoleRef.Kind != "ClusterRole" ||
-			impersonatorCRB.RoleRef.APIGroup != "rbac.authorization.k8s.io" ||
-			impersonatorCRB.RoleRef.Name != impersonatorName {
-			impersonatorCRB.RoleRef = impersonatorRoleRef
+	return r.ensure(ctx, sa, desired.roleBinding, func(current client.Object, drift *driftTracker) {
+		drift.track("subjects", current.(*rbacv1.RoleBinding).Subjects, desired.roleBinding.Subjects) //nolint:forcetypeassert
+	})
+}
+
+// deleteImpersonatorRole deletes, if present and managed by the addon, the impersonator Role and RoleBinding of the
+// ServiceAccount, once the impersonation of the ServiceAccount itself is not requested anymore.
+func (r *ServiceAccountReconciler) deleteImpersonatorRole(ctx context.Context, sa *corev1.ServiceAccount) error {
+	key := types.NamespacedName{Namespace: sa.Namespace, Name: impersonatorRoleName(sa)}
+
+	for _, obj := range []client.Object{&rbacv1.RoleBinding{}, &rbacv1.Role{}} {
+		if err := r.Client.Get(ctx, key, obj); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+
+			continue
 		}
-		if len(impersonatorCRB.Subjects) == 0 {
-			impersonatorCRB.Subjects = subjects
+
+		if obj.GetLabels()[LabelManagedBy] != ManagerName {
+			continue
 		}
 
+		if err := r.delete(ctx, sa, obj); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeAggregationRule removes the aggregation rule set on the impersonator ClusterRole of which the name is specified.
+func (r *ServiceAccountReconciler) removeAggregationRule(ctx context.Context, sa *corev1.ServiceAccount, name string) error {
+	current := new(rbacv1.ClusterRole)
+	if err := r.Client.Get(ctx, client.ObjectKey{Name: name}, current); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if current.AggregationRule == nil {
 		return nil
-	}); err != nil {
+	}
+
+	current.AggregationRule = nil
+
+	if err := r.update(ctx, sa, current, "aggregationRule"); err != nil {
 		return err
 	}
 
+	r.recordCorrection(ctx, sa, Correction{Kind: "ClusterRole", Name: name, Fields: []string{"aggregationRule"}})
+
 	return nil
 }
+
+// impersonatorRules returns the rules granting the ServiceAccount the impersonation of its own identity on the
+// resources specified: the cluster-wide ones, for the ClusterRole, and the namespaced ones, for the Role in the
+// ServiceAccount Namespace.
+// The ServiceAccount impersonation is authorized by name within the Namespace of the ServiceAccount, thus it must not
+// be granted cluster-wide, where it would match the ServiceAccounts with the same name in any Namespace.
+func impersonatorRules(sa *corev1.ServiceAccount, resources []string) (cluster, namespaced []rbacv1.PolicyRule) {
+	for _, resource := range resources {
+		rule := rbacv1.PolicyRule{
+			APIGroups: []string{""},
+			Verbs:     []string{"impersonate"},
+			Resources: []string{resource},
+		}
+
+		switch resource {
+		case ImpersonatorResourceUsers:
+			rule.ResourceNames = []string{serviceAccountUsername(sa.Namespace, sa.Name)}
+			cluster = append(cluster, rule)
+		case ImpersonatorResourceGroups:
+			rule.ResourceNames = []string{"system:serviceaccounts", "system:serviceaccounts:" + sa.Namespace, "system:authenticated"}
+			cluster = append(cluster, rule)
+		case ImpersonatorResourceServiceAccounts:
+			rule.ResourceNames = []string{sa.Name}
+			namespaced = append(namespaced, rule)
+		}
+	}
+
+	return cluster, namespaced
+}
+
+// impersonatorClusterRoleName returns the name of the impersonator ClusterRole, and ClusterRoleBinding, of the
+// ServiceAccount.
+func impersonatorClusterRoleName(sa *corev1.ServiceAccount) string {
+	return fmt.Sprintf("%s-%s-impersonator", sa.Namespace, sa.Name)
+}
+
+// impersonatorRoleName returns the name of the impersonator Role, and RoleBinding, of the ServiceAccount, placed in its
+// Namespace.
+func impersonatorRoleName(sa *corev1.ServiceAccount) string {
+	return fmt.Sprintf("%s%s", sa.Name, ImpersonatorRoleSuffix)
+}
+
+// rbacLabels returns the labels of the RBAC objects generated for the ServiceAccount, on top of the existing ones.
+func rbacLabels(labels map[string]string, sa *corev1.ServiceAccount) map[string]string {
+	out := make(map[string]string, len(labels)+3)
+
+	for k, v := range labels {
+		out[k] = v
+	}
+
+	out[LabelManagedBy] = ManagerName
+	out[LabelServiceAccountName] = sa.Name
+	out[LabelServiceAccountNamespace] = sa.Namespace
+
+	return out
+}
+
+// deleteRoleBindingWithStaleRoleRef deletes the existing RoleBinding, if its roleRef differs from the desired one,
+// returning true if deleted.
+func (r *ServiceAccountReconciler) deleteRoleBindingWithStaleRoleRef(ctx context.Context, sa *corev1.ServiceAccount, desired *rbacv1.RoleBinding) (bool, error) {
+	current := new(rbacv1.RoleBinding)
+	if err := r.Client.Get(ctx, client.ObjectKeyFromObject(desired), current); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+
+	if current.RoleRef == desired.RoleRef {
+		return false, nil
+	}
+
+	return true, r.delete(ctx, sa, current)
+}
+
+// deleteClusterRoleBindingWithStaleRoleRef deletes the existing ClusterRoleBinding, if its roleRef differs from the
+// desired one.
+func (r *ServiceAccountReconciler) deleteClusterRoleBindingWithStaleRoleRef(ctx context.Context, sa *corev1.ServiceAccount, desired *rbacv1.ClusterRoleBinding) (bool, error) {
+	current := new(rbacv1.ClusterRoleBinding)
+	if err := r.Client.Get(ctx, client.ObjectKeyFromObject(desired), current); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+
+	if current.RoleRef == desired.RoleRef {
+		return false, nil
+	}
+
+	return true, r.delete(ctx, sa, current)
+}
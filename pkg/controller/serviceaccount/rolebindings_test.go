@@ -0,0 +1,87 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestImpersonatorRules(t *testing.T) {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "oil-system", Name: "gitops-reconciler"}}
+
+	users := rbacv1.PolicyRule{
+		APIGroups:     []string{""},
+		Verbs:         []string{"impersonate"},
+		Resources:     []string{"users"},
+		ResourceNames: []string{"system:serviceaccount:oil-system:gitops-reconciler"},
+	}
+	groups := rbacv1.PolicyRule{
+		APIGroups:     []string{""},
+		Verbs:         []string{"impersonate"},
+		Resources:     []string{"groups"},
+		ResourceNames: []string{"system:serviceaccounts", "system:serviceaccounts:oil-system", "system:authenticated"},
+	}
+	serviceAccounts := rbacv1.PolicyRule{
+		APIGroups:     []string{""},
+		Verbs:         []string{"impersonate"},
+		Resources:     []string{"serviceaccounts"},
+		ResourceNames: []string{"gitops-reconciler"},
+	}
+
+	tests := []struct {
+		name       string
+		resources  []string
+		cluster    []rbacv1.PolicyRule
+		namespaced []rbacv1.PolicyRule
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:      "users",
+			resources: []string{ImpersonatorResourceUsers},
+			cluster:   []rbacv1.PolicyRule{users},
+		},
+		{
+			name:      "groups",
+			resources: []string{ImpersonatorResourceGroups},
+			cluster:   []rbacv1.PolicyRule{groups},
+		},
+		{
+			name:       "serviceaccounts",
+			resources:  []string{ImpersonatorResourceServiceAccounts},
+			namespaced: []rbacv1.PolicyRule{serviceAccounts},
+		},
+		{
+			name:       "all",
+			resources:  []string{ImpersonatorResourceUsers, ImpersonatorResourceServiceAccounts, ImpersonatorResourceGroups},
+			cluster:    []rbacv1.PolicyRule{users, groups},
+			namespaced: []rbacv1.PolicyRule{serviceAccounts},
+		},
+		{
+			name:      "unknown",
+			resources: []string{"nodes", ImpersonatorResourceUsers},
+			cluster:   []rbacv1.PolicyRule{users},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cluster, namespaced := impersonatorRules(sa, tt.resources)
+
+			if !equality.Semantic.DeepEqual(cluster, tt.cluster) {
+				t.Fatalf("expected the cluster rules %v, got %v", tt.cluster, cluster)
+			}
+
+			if !equality.Semantic.DeepEqual(namespaced, tt.namespaced) {
+				t.Fatalf("expected the namespaced rules %v, got %v", tt.namespaced, namespaced)
+			}
+		})
+	}
+}
@@ -6,29 +6,49 @@ package serviceaccount
 import (
 	"context"
 	"fmt"
+	"strings"
+	"sync/atomic"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	clientcmdlatest "k8s.io/client-go/tools/clientcmd/api/latest"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/indexer"
 )
 
 //nolint:revive
 type ServiceAccountReconciler struct {
-	proxyURL string
-	proxyCA  string
+	proxyURL           string
+	proxyCA            string
+	distribution       string
+	ownerGroupPatterns []string
+	tenantResolvers    []TenantResolver
+	configurationName  string
+	bootstrapSources   []schema.GroupVersionKind
+	notifications      bool
+	fluxControllers    []rbacv1.Subject
+	recorder           record.EventRecorder
+	dryRun             bool
+	paused             bool
+	proxyVerification  bool
+	// validatedConfiguration is the last validated specification of the AddonConfiguration in use.
+	validatedConfiguration atomic.Pointer[v1alpha1.AddonConfigurationSpec]
 
 	Client client.Client
 	Log    logr.Logger
@@ -60,6 +80,96 @@ func WithProxyURL(proxyURL string) Option {
 	}
 }
 
+// WithDistribution sets the default Capsule resource used to distribute the kubeConfig Secret across the Tenant
+// Namespaces, when not specified at ServiceAccount-level.
+func WithDistribution(distribution string) Option {
+	return func(r *ServiceAccountReconciler) {
+		r.distribution = distribution
+	}
+}
+
+// WithOwnerGroupPatterns sets the patterns of the Groups a ServiceAccount is a member of, used to resolve the Tenants
+// owned through a Group owner. Patterns can contain the OwnerGroupPatternNamespace and OwnerGroupPatternName
+// placeholders.
+func WithOwnerGroupPatterns(patterns []string) Option {
+	return func(r *ServiceAccountReconciler) {
+		r.ownerGroupPatterns = patterns
+	}
+}
+
+// WithTenantResolvers sets the TenantResolvers used to resolve the Tenants owned by a ServiceAccount.
+func WithTenantResolvers(resolvers ...TenantResolver) Option {
+	return func(r *ServiceAccountReconciler) {
+		r.tenantResolvers = resolvers
+	}
+}
+
+// WithConfigurationName sets the name of the AddonConfiguration defining the platform defaults.
+func WithConfigurationName(name string) Option {
+	return func(r *ServiceAccountReconciler) {
+		r.configurationName = name
+	}
+}
+
+// WithBootstrapSources enables the bootstrap of the Flux sources and Kustomization of the ServiceAccounts, for the
+// installed Flux sources specified.
+func WithBootstrapSources(sources ...schema.GroupVersionKind) Option {
+	return func(r *ServiceAccountReconciler) {
+		r.bootstrapSources = sources
+	}
+}
+
+// WithNotifications enables the generation of the Flux notification Provider and Alert of the ServiceAccounts,
+// requiring the Flux notification API to be installed.
+func WithNotifications(enabled bool) Option {
+	return func(r *ServiceAccountReconciler) {
+		r.notifications = enabled
+	}
+}
+
+// WithFluxControllers sets the ServiceAccounts of the Flux controllers granted the impersonation of the ServiceAccounts
+// in the impersonation mode.
+func WithFluxControllers(controllers []rbacv1.Subject) Option {
+	return func(r *ServiceAccountReconciler) {
+		r.fluxControllers = controllers
+	}
+}
+
+// WithEventRecorder sets the recorder of the Events emitted on the ServiceAccounts, such as for the drift corrections.
+func WithEventRecorder(recorder record.EventRecorder) Option {
+	return func(r *ServiceAccountReconciler) {
+		r.recorder = recorder
+	}
+}
+
+// WithDryRun enables the dry-run mode: the objects are computed as usual, but the writes are only logged and reported
+// with Events on the ServiceAccounts, describing the changes.
+func WithDryRun(dryRun bool) Option {
+	return func(r *ServiceAccountReconciler) {
+		r.dryRun = dryRun
+	}
+}
+
+// DryRun returns true if the dry-run mode is enabled.
+func (r *ServiceAccountReconciler) DryRun() bool {
+	return r.dryRun
+}
+
+// WithPaused pauses the reconciliation of all the ServiceAccounts: the generated objects are left as they are.
+func WithPaused(paused bool) Option {
+	return func(r *ServiceAccountReconciler) {
+		r.paused = paused
+	}
+}
+
+// WithProxyVerification enables the verification of the kubeConfigs against the Capsule Proxy before publishing them:
+// a kubeConfig is published only once its token authenticates the ServiceAccount through the Capsule Proxy.
+func WithProxyVerification(enabled bool) Option {
+	return func(r *ServiceAccountReconciler) {
+		r.proxyVerification = enabled
+	}
+}
+
 func NewServiceAccountReconciler(opts ...Option) *ServiceAccountReconciler {
 	reconciler := new(ServiceAccountReconciler)
 
@@ -67,156 +177,202 @@ func NewServiceAccountReconciler(opts ...Option) *ServiceAccountReconciler {
 		f(reconciler)
 	}
 
+	if len(reconciler.tenantResolvers) == 0 {
+		reconciler.tenantResolvers = []TenantResolver{OwnersTenantResolver{}}
+	}
+
 	return reconciler
 }
 
-func (r *ServiceAccountReconciler) SetupWithManager(ctx context.Context, mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&corev1.ServiceAccount{}, r.forOption(ctx)).
-		Owns(&capsulev1beta2.GlobalTenantResource{}).
+func (r *ServiceAccountReconciler) SetupWithManager(_ context.Context, mgr ctrl.Manager) error {
+	bldr := ctrl.NewControllerManagedBy(mgr)
+
+	for _, gvk := range append(r.BootstrapGroupVersionKinds(), r.NotificationGroupVersionKinds()...) {
+		obj := new(unstructured.Unstructured)
+		obj.SetGroupVersionKind(gvk)
+
+		bldr = bldr.Owns(obj)
+	}
+
+	// Watch the generated objects, in order to correct their drift.
+	for _, obj := range GeneratedObjects() {
+		bldr = bldr.Watches(obj, handler.EnqueueRequestsFromMapFunc(r.serviceAccountForObject))
+	}
+
+	return bldr.
+		For(&corev1.ServiceAccount{}, r.forOption()).
+		Watches(&capsulev1beta2.Tenant{}, handler.EnqueueRequestsFromMapFunc(r.serviceAccountsForTenant)).
+		Watches(&v1alpha1.FluxTenantCredential{}, handler.EnqueueRequestsFromMapFunc(r.serviceAccountForCredential)).
+		Watches(&v1alpha1.AddonConfiguration{}, handler.EnqueueRequestsFromMapFunc(r.serviceAccountsForConfiguration)).
 		Complete(r)
 }
 
 func (r *ServiceAccountReconciler) Reconcile(ctx context.Context, request ctrl.Request) (ctrl.Result, error) {
-	r.Log = r.Log.WithValues("Request.NamespacedName", request.NamespacedName)
+	log := r.Log.WithValues("Request.NamespacedName", request.NamespacedName)
+	// The reconciler is shared by the concurrent reconciliations: the logger of the request is carried by the context.
+	ctx = logr.NewContext(ctx, log)
 
 	// Unmarshal ServiceAccount object.
 	sa := new(corev1.ServiceAccount)
 	if err := r.Client.Get(ctx, request.NamespacedName, sa); err != nil {
 		if apierrors.IsNotFound(err) {
-			r.Log.Info("Request object not found, could have been deleted after reconcile request")
+			log.Info("Request object not found, could have been deleted after reconcile request")
+
+			if r.paused {
+				log.Info("Reconciliation is paused at manager-level, skipping the garbage collection")
+
+				return reconcile.Result{}, nil
+			}
+
+			// Garbage collect the cluster-scoped objects left by the deleted ServiceAccount, not controlled by it.
+			if err = r.deleteOrphaned(ctx, request.Namespace, request.Name); err != nil {
+				return reconcile.Result{}, errors.Wrap(err, "error deleting the orphaned objects")
+			}
 
 			return reconcile.Result{}, nil
 		}
 
-		r.Log.Error(err, "Error reading the object")
+		log.Error(err, "Error reading the object")
 
 		return ctrl.Result{}, err
 	}
 
-	// Ensure the (Cluster)RoleBindings for the ServiceAccount.
-	if err := r.ensureRoles(ctx, sa.Name, sa.Namespace); err != nil {
-		return reconcile.Result{}, errors.Wrap(err, "error ensuring the role bindings for the service account")
+	// ServiceAccounts referred by a FluxTenantCredential are reconciled by its controller.
+	managed, err := r.isCredentialManaged(ctx, sa)
+	if err != nil {
+		return reconcile.Result{}, errors.Wrap(err, "error listing FluxTenantCredentials for service account")
 	}
 
-	// Ensure ServiceAccount token.
-	if err := r.ensureSATokenSecret(ctx, sa.Name, sa.Namespace); err != nil {
-		return reconcile.Result{}, errors.Wrap(err, "error ensuring token of the service account")
+	if managed {
+		log.Info("ServiceAccount is managed by a FluxTenantCredential")
+
+		return reconcile.Result{}, nil
 	}
 
-	tokenSecret, err := r.getSATokenSecret(ctx, sa.Name, sa.Namespace)
+	// Skip all the writes while the reconciliation is paused.
+	message, err := r.Paused(ctx, sa)
 	if err != nil {
-		return reconcile.Result{}, errors.Wrap(err, "error getting token of the service account")
+		return reconcile.Result{}, errors.Wrap(err, "error checking whether the reconciliation is paused")
 	}
 
-	if tokenSecret.Data == nil {
-		r.Log.Info("ServiceAccount token data is missing. Requeueing.")
+	if message != "" {
+		r.recordPaused(ctx, sa, message)
 
-		return reconcile.Result{Requeue: true}, nil
+		return reconcile.Result{}, nil
 	}
 
-	// Build the kubeConfig for the ServiceAccount Tenant Owner.
-	config := r.buildKubeconfig(r.proxyURL, string(tokenSecret.Data[corev1.ServiceAccountTokenKey]))
+	// Garbage collect the kubeConfig distribution when the ServiceAccount is not enabled anymore.
+	if !IsAddonEnabled(sa) {
+		log.Info("ServiceAccount is not enabled")
 
-	configRaw, err := clientcmd.Write(*config)
-	if err != nil {
-		return reconcile.Result{}, errors.Wrap(err, "error building the tenant owner config")
-	}
+		if err = r.deleteGenerated(ctx, sa.Name, sa.Namespace); err != nil {
+			return reconcile.Result{}, err
+		}
 
-	secret := &corev1.Secret{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "Secret",
-			APIVersion: "v1",
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("%s%s", sa.Name, SecretNameSuffixKubeconfig),
-			Namespace: sa.Namespace,
-		},
-		Type: corev1.SecretTypeOpaque,
-		Data: map[string][]byte{
-			SecretKeyKubeconfig: configRaw,
-		},
-	}
-	if _, err = controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
-		return nil
-	}); err != nil {
-		return reconcile.Result{}, errors.Wrap(err, "error ensuring the kubeConfig secret")
+		return reconcile.Result{}, nil
 	}
 
-	// Get the Tenant owned by the ServiceAccount.
-	ownerName := fmt.Sprintf("system:serviceaccount:%s:%s", sa.GetNamespace(), sa.GetName())
+	settings, err := r.AnnotationSettings(ctx, sa)
 
-	tenantList, err := r.listTenantsOwned(ctx, string(capsulev1beta2.ServiceAccountOwner), ownerName)
-	if err != nil {
-		return reconcile.Result{}, errors.Wrap(err, "error listing Tenants for owner")
-	}
+	switch {
+	case errors.Is(err, ErrConfigurationNotValidated):
+		log.Info("AddonConfiguration is not validated yet. Requeueing.")
 
-	if tenantList.Items == nil {
-		return reconcile.Result{}, errors.New("Tenant list for owner is empty")
+		return reconcile.Result{Requeue: true}, nil
+	case err != nil:
+		return reconcile.Result{}, err
 	}
 
-	// Get the ServiceAccount's Namespace.
-	ns := new(corev1.Namespace)
-	if err = r.Client.Get(ctx, types.NamespacedName{Namespace: "", Name: sa.Namespace}, ns); err != nil {
-		if apierrors.IsNotFound(err) {
-			r.Log.Info("ServiceAccount Namespace is missing. Requeueing.")
+	credential, err := r.Issue(ctx, sa, settings)
 
-			return reconcile.Result{Requeue: true}, nil
-		}
+	switch {
+	case errors.Is(err, ErrServiceAccountNotTenantOwner):
+		log.Info("ServiceAccount is not a Tenant owner")
 
-		r.Log.Error(err, "Error reading the object")
+		return reconcile.Result{}, nil
+	case errors.Is(err, ErrServiceAccountTokenSecretEmpty):
+		log.Info("ServiceAccount token data is missing. Requeueing.")
+
+		return reconcile.Result{Requeue: true}, nil
+	case errors.Is(err, ErrProxyVerificationFailed):
+		log.Info("ServiceAccount kubeConfig is not verified against the Capsule Proxy. Requeueing.")
 
+		return reconcile.Result{Requeue: true}, nil
+	case err != nil:
 		return reconcile.Result{}, err
 	}
-	// And set the first Tenant owned by the SA as Namespace owner.
-	if err = r.setNamespaceOwnerRef(ctx, ns, tenantList.Items[0].DeepCopy()); err != nil {
-		return reconcile.Result{}, errors.Wrap(err, "error setting the owner reference on the namespace")
-	}
-	// If the option for distributing the kubeConfig to Tenant globally.
-	if sa.GetAnnotations()[ServiceAccountGlobalAnnotationKey] == ServiceAccountGlobalAnnotationValue {
-		for _, tenant := range tenantList.Items {
-			// Ensure the GlobalTenantResource to distribute the kubeConfig Secret.
-			name := fmt.Sprintf("%s-%s%s", tenant.Name, sa.Name, GlobalTenantResourceSuffix)
-			if err = r.ensureGlobalTenantResource(ctx, name, tenant.Name, secret); err != nil {
-				return reconcile.Result{}, errors.Wrap(err, "error ensuring the kubeConfig globaltenantresource")
-			}
-		}
+
+	log.Info("ServiceAccount reconciliation completed")
+
+	return reconcile.Result{RequeueAfter: credential.RequeueAfter}, nil
+}
+
+// logger returns the logger of the request carried by the context, if any, or the one of the reconciler otherwise.
+func (r *ServiceAccountReconciler) logger(ctx context.Context) logr.Logger {
+	if log, err := logr.FromContext(ctx); err == nil {
+		return log
 	}
 
-	r.Log.Info("ServiceAccount reconciliation completed")
+	return r.Log
+}
 
-	return reconcile.Result{}, nil
+// isCredentialManaged returns true if the ServiceAccount is referred by a FluxTenantCredential.
+func (r *ServiceAccountReconciler) isCredentialManaged(ctx context.Context, sa *corev1.ServiceAccount) (bool, error) {
+	ftcList := new(v1alpha1.FluxTenantCredentialList)
+	if err := r.Client.List(ctx, ftcList, client.InNamespace(sa.Namespace), client.MatchingFields{
+		indexer.FluxTenantCredentialServiceAccountField: sa.Name,
+	}); err != nil {
+		return false, err
+	}
+
+	return len(ftcList.Items) > 0, nil
+}
+
+// forOption is the option used to make reconciliation only of ServiceAccounts that have, or had before an update,
+// the required addon annotation.
+// The Tenant ownership is evaluated during the reconciliation, in order to garbage collect the generated resources
+// of ServiceAccounts that are not Tenant owners anymore.
+func (r *ServiceAccountReconciler) forOption() builder.ForOption {
+	return builder.WithPredicates(predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return IsAddonEnabled(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return IsAddonEnabled(e.ObjectOld) || IsAddonEnabled(e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return IsAddonEnabled(e.Object)
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return IsAddonEnabled(e.Object)
+		},
+	})
+}
+
+// IsAddonEnabled returns true if the object has the required addon annotation.
+func IsAddonEnabled(object client.Object) bool {
+	return object.GetAnnotations()[ServiceAccountAddonAnnotationKey] == ServiceAccountAddonAnnotationValue
 }
 
-// forOption is the option used to make reconciliation only of ServiceAccounts that both:
-// - have the required addon annotation, and
-// - are Tenant owners.
-func (r *ServiceAccountReconciler) forOption(ctx context.Context) builder.ForOption {
-	return builder.WithPredicates(
-		predicate.And(
-			predicate.NewPredicateFuncs(func(object client.Object) bool {
-				return object.GetAnnotations()[ServiceAccountAddonAnnotationKey] == ServiceAccountAddonAnnotationValue
-			}),
-			predicate.NewPredicateFuncs(func(object client.Object) bool {
-				ownerName := fmt.Sprintf("system:serviceaccount:%s:%s", object.GetNamespace(), object.GetName())
-				tntList, err := r.listTenantsOwned(ctx, string(capsulev1beta2.ServiceAccountOwner), ownerName)
-
-				return err == nil && tntList.Items != nil && len(tntList.Items) != 0
-			}),
-		),
-	)
+// serviceAccountUsername returns the username of the ServiceAccount of which the namespace and the name are
+// specified as arguments.
+func serviceAccountUsername(namespace, name string) string {
+	return fmt.Sprintf("%s%s:%s", serviceAccountUsernamePrefix, namespace, name)
 }
 
-// listTenantsOwned returns the first Tenant object owned by the ServiceAccount of which the name and the
-// namespace are specified as arguments.
-func (r *ServiceAccountReconciler) listTenantsOwned(ctx context.Context, ownerKind, ownerName string) (*capsulev1beta2.TenantList, error) {
-	tntList := &capsulev1beta2.TenantList{}
-	fields := client.MatchingFields{
-		".spec.owner.ownerkind": fmt.Sprintf("%s:%s", ownerKind, ownerName),
+// parseServiceAccountUsername returns the namespace and the name of the ServiceAccount of which the username is
+// specified as argument.
+func parseServiceAccountUsername(username string) (namespace, name string, ok bool) {
+	if !strings.HasPrefix(username, serviceAccountUsernamePrefix) {
+		return "", "", false
+	}
+
+	parts := strings.Split(strings.TrimPrefix(username, serviceAccountUsernamePrefix), ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
 	}
-	err := r.Client.List(ctx, tntList, fields)
 
-	return tntList, err
+	return parts[0], parts[1], true
 }
 
 // buildKubeconfig returns a client-go/clientcmd/api.Config with a token and server URL specified as arguments.
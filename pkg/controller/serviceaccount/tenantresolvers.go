@@ -0,0 +1,282 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Identity is the identity of a ServiceAccount as seen by Capsule when resolving the Tenant ownership.
+type Identity struct {
+	Namespace string
+	Name      string
+	// Groups the ServiceAccount is a member of.
+	Groups []string
+}
+
+// Username returns the Kubernetes username of the ServiceAccount.
+func (i Identity) Username() string {
+	return serviceAccountUsername(i.Namespace, i.Name)
+}
+
+// matchesSubject returns true if the subject, of the specified kind and name, refers to the identity.
+func (i Identity) matchesSubject(kind, name string) bool {
+	switch kind {
+	case capsulev1beta2.ServiceAccountOwner.String(), capsulev1beta2.UserOwner.String():
+		return name == i.Username()
+	case capsulev1beta2.GroupOwner.String():
+		for _, group := range i.Groups {
+			if group == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// TenantResolver resolves the Tenants owned by a ServiceAccount.
+type TenantResolver interface {
+	// Name returns the name of the resolver.
+	Name() string
+	// Resolve returns the Tenants owned by the ServiceAccount identity.
+	Resolve(ctx context.Context, c client.Reader, identity Identity) ([]capsulev1beta2.Tenant, error)
+}
+
+// OwnersTenantResolver resolves the Tenants listing the ServiceAccount in spec.owners, either as ServiceAccount or
+// User owner, or through the membership to a Group owner.
+// It relies on the Capsule Tenant owner field indexer.
+type OwnersTenantResolver struct{}
+
+func (OwnersTenantResolver) Name() string {
+	return "owners"
+}
+
+func (OwnersTenantResolver) Resolve(ctx context.Context, c client.Reader, identity Identity) ([]capsulev1beta2.Tenant, error) {
+	owners := []string{
+		fmt.Sprintf("%s:%s", capsulev1beta2.ServiceAccountOwner, identity.Username()),
+		fmt.Sprintf("%s:%s", capsulev1beta2.UserOwner, identity.Username()),
+	}
+
+	for _, group := range identity.Groups {
+		owners = append(owners, fmt.Sprintf("%s:%s", capsulev1beta2.GroupOwner, group))
+	}
+
+	var out []capsulev1beta2.Tenant
+
+	for _, owner := range owners {
+		tntList := &capsulev1beta2.TenantList{}
+		if err := c.List(ctx, tntList, client.MatchingFields{".spec.owner.ownerkind": owner}); err != nil {
+			return nil, err
+		}
+
+		out = append(out, tntList.Items...)
+	}
+
+	return out, nil
+}
+
+// AdditionalRoleBindingsTenantResolver resolves the Tenants granting one of the ClusterRoles, set as owner ones, to
+// the ServiceAccount with spec.additionalRoleBindings.
+// The bindings of the other ClusterRoles, such as view, do not grant the Tenant ownership: issuing the credentials for
+// them would escalate the privileges of the ServiceAccount.
+type AdditionalRoleBindingsTenantResolver struct {
+	// ClusterRoles granting the Tenant ownership.
+	ClusterRoles []string
+}
+
+func (AdditionalRoleBindingsTenantResolver) Name() string {
+	return "additional-role-bindings"
+}
+
+func (a AdditionalRoleBindingsTenantResolver) Resolve(ctx context.Context, c client.Reader, identity Identity) ([]capsulev1beta2.Tenant, error) {
+	if len(a.ClusterRoles) == 0 {
+		return nil, nil
+	}
+
+	tntList := &capsulev1beta2.TenantList{}
+	if err := c.List(ctx, tntList); err != nil {
+		return nil, err
+	}
+
+	var out []capsulev1beta2.Tenant
+
+	for _, tnt := range tntList.Items {
+		if hasAdditionalRoleBinding(&tnt, identity, a.ClusterRoles) {
+			out = append(out, tnt)
+		}
+	}
+
+	return out, nil
+}
+
+// hasAdditionalRoleBinding returns true if one of the additional RoleBindings of the Tenant, binding one of the
+// ClusterRoles specified, refers to the identity.
+func hasAdditionalRoleBinding(tnt *capsulev1beta2.Tenant, identity Identity, clusterRoles []string) bool {
+	for _, binding := range tnt.Spec.AdditionalRoleBindings {
+		if !slices.Contains(clusterRoles, binding.ClusterRoleName) {
+			continue
+		}
+
+		for _, subject := range binding.Subjects {
+			if subject.Kind == rbacv1.ServiceAccountKind {
+				if subject.Namespace == identity.Namespace && subject.Name == identity.Name {
+					return true
+				}
+
+				continue
+			}
+
+			if identity.matchesSubject(subject.Kind, subject.Name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// TenantOwnerGroupVersionKind is the Capsule TenantOwner custom resource, which declares owners, selected by Tenants
+// by label with spec.permissions.matchOwners.
+var TenantOwnerGroupVersionKind = schema.GroupVersionKind{
+	Group:   capsulev1beta2.GroupVersion.Group,
+	Version: capsulev1beta2.GroupVersion.Version,
+	Kind:    "TenantOwner",
+}
+
+// TenantOwnerTenantResolver resolves the Tenants selecting a TenantOwner referring to the ServiceAccount.
+// Since the TenantOwner API is newer than the compiled Capsule API, objects are handled as unstructured.
+type TenantOwnerTenantResolver struct{}
+
+func (TenantOwnerTenantResolver) Name() string {
+	return "tenant-owners"
+}
+
+func (TenantOwnerTenantResolver) Resolve(ctx context.Context, c client.Reader, identity Identity) ([]capsulev1beta2.Tenant, error) {
+	ownerList := new(unstructured.UnstructuredList)
+	ownerList.SetGroupVersionKind(TenantOwnerGroupVersionKind.GroupVersion().WithKind(TenantOwnerGroupVersionKind.Kind + "List"))
+
+	if err := c.List(ctx, ownerList); err != nil {
+		return nil, err
+	}
+
+	var ownerLabels []labels.Set
+
+	for _, owner := range ownerList.Items {
+		kind, _, _ := unstructured.NestedString(owner.Object, "spec", "kind")
+		name, _, _ := unstructured.NestedString(owner.Object, "spec", "name")
+
+		if identity.matchesSubject(kind, name) {
+			ownerLabels = append(ownerLabels, owner.GetLabels())
+		}
+	}
+
+	if len(ownerLabels) == 0 {
+		return nil, nil
+	}
+
+	tntList := new(unstructured.UnstructuredList)
+	tntList.SetGroupVersionKind(capsulev1beta2.GroupVersion.WithKind("TenantList"))
+
+	if err := c.List(ctx, tntList); err != nil {
+		return nil, err
+	}
+
+	var out []capsulev1beta2.Tenant
+
+	for _, item := range tntList.Items {
+		matches, err := matchesTenantOwners(item, ownerLabels)
+		if err != nil {
+			return nil, err
+		}
+
+		if !matches {
+			continue
+		}
+
+		// The Tenant could have been deleted meanwhile: the other ones are still served.
+		tnt := capsulev1beta2.Tenant{}
+		if err = c.Get(ctx, types.NamespacedName{Name: item.GetName()}, &tnt); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		out = append(out, tnt)
+	}
+
+	return out, nil
+}
+
+// matchesTenantOwners returns true if one of the spec.permissions.matchOwners selectors of the unstructured Tenant
+// matches one of the TenantOwner labels.
+func matchesTenantOwners(tnt unstructured.Unstructured, ownerLabels []labels.Set) (bool, error) {
+	rawSelectors, _, err := unstructured.NestedSlice(tnt.Object, "spec", "permissions", "matchOwners")
+	if err != nil {
+		return false, err
+	}
+
+	for _, raw := range rawSelectors {
+		rawMap, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		ls := metav1.LabelSelector{}
+		if err = runtime.DefaultUnstructuredConverter.FromUnstructured(rawMap, &ls); err != nil {
+			return false, err
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(&ls)
+		if err != nil {
+			return false, err
+		}
+		// An empty selector would select all the TenantOwners.
+		if selector.Empty() {
+			continue
+		}
+
+		for _, set := range ownerLabels {
+			if selector.Matches(set) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// DetectTenantResolvers returns the TenantResolvers supported by the installed Capsule API.
+// The classic owners are always supported, and the TenantOwner resolver is enabled only when the TenantOwner custom
+// resource is installed. The additional RoleBindings resolver is opt-in, enabled only when the ClusterRoles granting
+// the Tenant ownership are specified.
+func DetectTenantResolvers(mapper meta.RESTMapper, ownerClusterRoles []string) []TenantResolver {
+	resolvers := []TenantResolver{OwnersTenantResolver{}}
+
+	if len(ownerClusterRoles) > 0 {
+		resolvers = append(resolvers, AdditionalRoleBindingsTenantResolver{ClusterRoles: ownerClusterRoles})
+	}
+
+	if _, err := mapper.RESTMapping(TenantOwnerGroupVersionKind.GroupKind(), TenantOwnerGroupVersionKind.Version); err == nil {
+		resolvers = append(resolvers, TenantOwnerTenantResolver{})
+	}
+
+	return resolvers
+}
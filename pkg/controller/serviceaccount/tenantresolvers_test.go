@@ -0,0 +1,208 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/pkg/errors"
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	"github.com/projectcapsule/capsule/pkg/api"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestTenantOwnerTenantResolver(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := capsulev1beta2.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	scheme.AddKnownTypeWithName(TenantOwnerGroupVersionKind, &unstructured.Unstructured{})
+	scheme.AddKnownTypeWithName(TenantOwnerGroupVersionKind.GroupVersion().WithKind(TenantOwnerGroupVersionKind.Kind+"List"), &unstructured.UnstructuredList{})
+
+	identity := Identity{Namespace: "oil-system", Name: "gitops-reconciler"}
+
+	owner := &unstructured.Unstructured{}
+	owner.SetGroupVersionKind(TenantOwnerGroupVersionKind)
+	owner.SetName("gitops-reconciler")
+	owner.SetLabels(map[string]string{"team": "oil"})
+	_ = unstructured.SetNestedField(owner.Object, capsulev1beta2.ServiceAccountOwner.String(), "spec", "kind")
+	_ = unstructured.SetNestedField(owner.Object, identity.Username(), "spec", "name")
+
+	// The compiled Tenant API lacks spec.permissions: the Tenants are listed as unstructured ones.
+	tenants := map[string]map[string]interface{}{
+		"deleted": {"team": "oil"},
+		"oil":     {"team": "oil"},
+		"gas":     {"team": "gas"},
+	}
+
+	listTenants := func(ctx context.Context, c client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+		tntList, ok := list.(*unstructured.UnstructuredList)
+		if !ok || tntList.GetKind() != "TenantList" {
+			return c.List(ctx, list, opts...)
+		}
+
+		for _, name := range []string{"deleted", "gas", "oil"} {
+			tnt := unstructured.Unstructured{}
+			tnt.SetGroupVersionKind(capsulev1beta2.GroupVersion.WithKind("Tenant"))
+			tnt.SetName(name)
+			_ = unstructured.SetNestedSlice(tnt.Object, []interface{}{map[string]interface{}{"matchLabels": tenants[name]}}, "spec", "permissions", "matchOwners")
+
+			tntList.Items = append(tntList.Items, tnt)
+		}
+
+		return nil
+	}
+
+	tests := []struct {
+		name    string
+		get     error
+		tenants []string
+		err     bool
+	}{
+		{name: "deleted tenant", get: apierrors.NewNotFound(capsulev1beta2.GroupVersion.WithResource("tenants").GroupResource(), "deleted"), tenants: []string{"oil"}},
+		{name: "failing tenant", get: errors.New("connection refused"), err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(owner, &capsulev1beta2.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "oil"}}, &capsulev1beta2.Tenant{ObjectMeta: metav1.ObjectMeta{Name: "gas"}}).
+				WithInterceptorFuncs(interceptor.Funcs{
+					List: listTenants,
+					Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+						if key.Name == "deleted" {
+							return tt.get
+						}
+
+						return c.Get(ctx, key, obj, opts...)
+					},
+				}).
+				Build()
+
+			out, err := TenantOwnerTenantResolver{}.Resolve(context.Background(), c, identity)
+			if tt.err {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			names := make([]string, 0, len(out))
+			for _, tnt := range out {
+				names = append(names, tnt.Name)
+			}
+
+			if !slices.Equal(names, tt.tenants) {
+				t.Fatalf("expected the Tenants %v, got %v", tt.tenants, names)
+			}
+		})
+	}
+}
+
+func TestAdditionalRoleBindingsTenantResolver(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := capsulev1beta2.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	identity := Identity{Namespace: "oil-system", Name: "gitops-reconciler", Groups: []string{"system:serviceaccounts:oil-system"}}
+
+	newTenant := func(name, clusterRole string, subject rbacv1.Subject) *capsulev1beta2.Tenant {
+		return &capsulev1beta2.Tenant{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: capsulev1beta2.TenantSpec{
+				AdditionalRoleBindings: []api.AdditionalRoleBindingsSpec{{ClusterRoleName: clusterRole, Subjects: []rbacv1.Subject{subject}}},
+			},
+		}
+	}
+
+	serviceAccount := rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: "oil-system", Name: "gitops-reconciler"}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newTenant("admin", "admin", serviceAccount),
+		newTenant("view", "view", serviceAccount),
+		newTenant("group", "admin", rbacv1.Subject{Kind: rbacv1.GroupKind, Name: "system:serviceaccounts:oil-system"}),
+		newTenant("other-namespace", "admin", rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: "gas-system", Name: "gitops-reconciler"}),
+	).Build()
+
+	tests := []struct {
+		name         string
+		clusterRoles []string
+		tenants      []string
+	}{
+		{name: "no owner ClusterRoles"},
+		{name: "owner ClusterRole", clusterRoles: []string{"admin"}, tenants: []string{"admin", "group"}},
+		{name: "owner ClusterRoles", clusterRoles: []string{"admin", "view"}, tenants: []string{"admin", "group", "view"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := AdditionalRoleBindingsTenantResolver{ClusterRoles: tt.clusterRoles}.Resolve(context.Background(), c, identity)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			names := make([]string, 0, len(out))
+			for _, tnt := range out {
+				names = append(names, tnt.Name)
+			}
+
+			slices.Sort(names)
+
+			if !slices.Equal(names, tt.tenants) {
+				t.Fatalf("expected the Tenants %v, got %v", tt.tenants, names)
+			}
+		})
+	}
+}
+
+func TestDetectTenantResolvers(t *testing.T) {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{capsulev1beta2.GroupVersion})
+
+	tests := []struct {
+		name              string
+		ownerClusterRoles []string
+		tenantOwner       bool
+		resolvers         []string
+	}{
+		{name: "default", resolvers: []string{"owners"}},
+		{name: "owner ClusterRoles", ownerClusterRoles: []string{"admin"}, resolvers: []string{"owners", "additional-role-bindings"}},
+		{name: "TenantOwner API", tenantOwner: true, resolvers: []string{"owners", "tenant-owners"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.tenantOwner {
+				mapper.Add(TenantOwnerGroupVersionKind, meta.RESTScopeRoot)
+			}
+
+			names := make([]string, 0)
+			for _, resolver := range DetectTenantResolvers(mapper, tt.ownerClusterRoles) {
+				names = append(names, resolver.Name())
+			}
+
+			if !slices.Equal(names, tt.resolvers) {
+				t.Fatalf("expected the resolvers %v, got %v", tt.resolvers, names)
+			}
+		})
+	}
+}
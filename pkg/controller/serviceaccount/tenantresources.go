@@ -0,0 +1,67 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"fmt"
+
+	capsulev1beta2 "github.com/projectcapsule/capsule/api/v1beta2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// ensureTenantResource ensures the namespaced TenantResource, placed in the ServiceAccount Namespace, to distribute
+// the kubeConfig Secret across the sibling Namespaces of the Tenant owning it.
+// The Secret is referenced by selector, in order to keep the credentials only in Secrets.
+func (r *ServiceAccountReconciler) ensureTenantResource(ctx context.Context, sa *corev1.ServiceAccount) error {
+	tr, err := r.desiredTenantResource(sa)
+	if err != nil {
+		return err
+	}
+
+	return r.ensure(ctx, sa, tr, func(current client.Object, drift *driftTracker) {
+		drift.trackSpec(&current.(*capsulev1beta2.TenantResource).Spec, &tr.Spec) //nolint:forcetypeassert
+	})
+}
+
+// desiredTenantResource returns the desired TenantResource distributing the kubeConfig Secret of the ServiceAccount
+// across the sibling Namespaces.
+func (r *ServiceAccountReconciler) desiredTenantResource(sa *corev1.ServiceAccount) (*capsulev1beta2.TenantResource, error) {
+	tr := &capsulev1beta2.TenantResource{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s%s", sa.Name, TenantResourceSuffix),
+			Namespace: sa.Namespace,
+			Labels:    rbacLabels(nil, sa),
+		},
+		Spec: kubeconfigTenantResourceSpec(sa),
+	}
+
+	if err := controllerutil.SetControllerReference(sa, tr, r.Client.Scheme()); err != nil {
+		return nil, err
+	}
+
+	return tr, nil
+}
+
+// deleteTenantResource deletes, if present and managed by the addon, the TenantResource distributing the kubeConfig
+// of the ServiceAccount of which the name and the namespace are specified as arguments.
+func (r *ServiceAccountReconciler) deleteTenantResource(ctx context.Context, saName, saNamespace string) error {
+	tr := new(capsulev1beta2.TenantResource)
+	if err := r.Client.Get(ctx, types.NamespacedName{
+		Namespace: saNamespace,
+		Name:      fmt.Sprintf("%s%s", saName, TenantResourceSuffix),
+	}, tr); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if tr.GetLabels()[LabelManagedBy] != ManagerName {
+		return nil
+	}
+
+	return r.delete(ctx, nil, tr)
+}
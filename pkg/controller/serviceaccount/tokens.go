@@ -6,36 +6,44 @@ package serviceaccount
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/pkg/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
-// ensureSATokenSecret ensures that a token Secret is present for the Service Account of which the name and the namespace
-// are specified as arguments.
-func (r *ServiceAccountReconciler) ensureSATokenSecret(ctx context.Context, name, namespace string) error {
+// ensureSATokenSecret ensures that a token Secret is present for the Service Account specified, generating it, and
+// controlled by the ServiceAccount, if missing.
+func (r *ServiceAccountReconciler) ensureSATokenSecret(ctx context.Context, sa *corev1.ServiceAccount) error {
 	// If the token does not exist, create it.
-	if _, err := r.getSATokenSecret(ctx, name, namespace); err != nil {
+	if _, err := r.getSATokenSecret(ctx, sa.Name, sa.Namespace); err != nil {
 		if errors.Is(err, ErrServiceAccountTokenNotFound) {
+			labels := rbacLabels(nil, sa)
+			labels[LabelComponent] = ComponentToken
+
 			tokenSecret := &corev1.Secret{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:      fmt.Sprintf("%s%s", name, SecretNameSuffixToken),
-					Namespace: namespace,
+					Name:      fmt.Sprintf("%s%s", sa.Name, SecretNameSuffixToken),
+					Namespace: sa.Namespace,
+					Labels:    labels,
 					Annotations: map[string]string{
-						corev1.ServiceAccountNameKey: name,
+						corev1.ServiceAccountNameKey: sa.Name,
 					},
 				},
 				Type: corev1.SecretTypeServiceAccountToken,
 			}
-			if _, err = controllerutil.CreateOrUpdate(ctx, r.Client, tokenSecret, func() error {
-				return nil
-			}); err != nil {
+
+			if err = controllerutil.SetControllerReference(sa, tokenSecret, r.Client.Scheme()); err != nil {
 				return err
 			}
 
-			return nil
+			return r.ensure(ctx, sa, tokenSecret, nil)
 		}
 
 		return err
@@ -72,3 +80,131 @@ func (r *ServiceAccountReconciler) getSATokenSecret(ctx context.Context, saName,
 
 	return tokenSecret, nil
 }
+
+// ensureToken returns the token to be set in the kubeConfig of the ServiceAccount, along with its expiration if any.
+// When a token lifetime is set, tokens are issued with the TokenRequest API and the current one is reused until its
+// rotation is due; otherwise the token of the ServiceAccount token Secret is used.
+func (r *ServiceAccountReconciler) ensureToken(ctx context.Context, sa *corev1.ServiceAccount, settings Settings) (string, time.Time, error) {
+	if settings.TokenExpiration == 0 {
+		if err := r.ensureSATokenSecret(ctx, sa); err != nil {
+			return "", time.Time{}, errors.Wrap(err, "error ensuring token of the service account")
+		}
+
+		tokenSecret, err := r.getSATokenSecret(ctx, sa.Name, sa.Namespace)
+		// In the dry-run mode, the token Secret is not created: the kubeConfig is computed with a placeholder.
+		if r.isDryRun(ctx) && (err != nil || len(tokenSecret.Data[corev1.ServiceAccountTokenKey]) == 0) {
+			return PlaceholderToken, time.Time{}, nil
+		}
+
+		if err != nil {
+			return "", time.Time{}, errors.Wrap(err, "error getting token of the service account")
+		}
+
+		if len(tokenSecret.Data[corev1.ServiceAccountTokenKey]) == 0 {
+			return "", time.Time{}, ErrServiceAccountTokenSecretEmpty
+		}
+
+		return string(tokenSecret.Data[corev1.ServiceAccountTokenKey]), time.Time{}, nil
+	}
+
+	if token, expiration, ok := r.currentKubeconfigToken(ctx, sa, settings); ok &&
+		time.Now().Before(tokenRotationTime(expiration, settings.TokenExpiration)) {
+		return token, expiration, nil
+	}
+
+	return r.requestSAToken(ctx, sa, settings.TokenExpiration)
+}
+
+// requestSAToken issues a token for the ServiceAccount with the TokenRequest API.
+// In the dry-run mode, no token is issued: a placeholder is returned instead.
+func (r *ServiceAccountReconciler) requestSAToken(ctx context.Context, sa *corev1.ServiceAccount, expiration time.Duration) (string, time.Time, error) {
+	if r.isDryRun(ctx) {
+		return PlaceholderToken, time.Now().Add(expiration), nil
+	}
+
+	expirationSeconds := int64(expiration.Seconds())
+
+	tokenRequest := &authenticationv1.TokenRequest{
+		Spec: authenticationv1.TokenRequestSpec{
+			ExpirationSeconds: &expirationSeconds,
+		},
+	}
+
+	if err := r.Client.SubResource("token").Create(ctx, sa, tokenRequest); err != nil {
+		return "", time.Time{}, errors.Wrap(ErrGetServiceAccountToken, err.Error())
+	}
+
+	return tokenRequest.Status.Token, tokenRequest.Status.ExpirationTimestamp.Time, nil
+}
+
+// currentKubeconfigToken returns the token, and its expiration, set in the current kubeConfig Secret of the
+// ServiceAccount, if any.
+func (r *ServiceAccountReconciler) currentKubeconfigToken(ctx context.Context, sa *corev1.ServiceAccount, settings Settings) (string, time.Time, bool) {
+	secret := new(corev1.Secret)
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: sa.Namespace, Name: settings.SecretName}, secret); err != nil {
+		return "", time.Time{}, false
+	}
+
+	expiration, err := time.Parse(time.RFC3339, secret.GetAnnotations()[KubeconfigTokenExpirationAnnotationKey])
+	if err != nil {
+		return "", time.Time{}, false
+	}
+
+	token, ok := kubeconfigToken(secret.Data[settings.SecretKey])
+
+	return token, expiration, ok
+}
+
+// kubeconfigToken returns the token of the ServiceAccount user set in the raw kubeConfig specified, if any.
+func kubeconfigToken(raw []byte) (string, bool) {
+	config, err := clientcmd.Load(raw)
+	if err != nil {
+		return "", false
+	}
+
+	authInfo, ok := config.AuthInfos[KubeconfigUserName]
+	if !ok || authInfo.Token == "" {
+		return "", false
+	}
+
+	return authInfo.Token, true
+}
+
+// Kubeconfig returns the kubeConfig of the ServiceAccount pointing to the Capsule Proxy, as issued with the Settings
+// specified, without writing any object.
+// When a token lifetime is specified, a fresh token is requested with the TokenRequest API; otherwise the token of the
+// issued kubeConfig Secret, or of the ServiceAccount token Secret, is used.
+func (r *ServiceAccountReconciler) Kubeconfig(ctx context.Context, sa *corev1.ServiceAccount, settings Settings, lifetime time.Duration) (*clientcmdapi.Config, error) {
+	if lifetime > 0 {
+		token, _, err := r.requestSAToken(ctx, sa, lifetime)
+		if err != nil {
+			return nil, err
+		}
+
+		return r.buildKubeconfig(settings.ProxyURL, token), nil
+	}
+
+	secret := new(corev1.Secret)
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: sa.Namespace, Name: settings.SecretName}, secret); err == nil {
+		if token, ok := kubeconfigToken(secret.Data[settings.SecretKey]); ok {
+			return r.buildKubeconfig(settings.ProxyURL, token), nil
+		}
+	}
+
+	tokenSecret, err := r.getSATokenSecret(ctx, sa.Name, sa.Namespace)
+	if err != nil {
+		return nil, errors.Wrap(err, "no token has been issued, a fresh one can be requested with a lifetime")
+	}
+
+	if len(tokenSecret.Data[corev1.ServiceAccountTokenKey]) == 0 {
+		return nil, ErrServiceAccountTokenSecretEmpty
+	}
+
+	return r.buildKubeconfig(settings.ProxyURL, string(tokenSecret.Data[corev1.ServiceAccountTokenKey])), nil
+}
+
+// tokenRotationTime returns the time after which a token, expiring at the time specified, must be rotated: that is
+// when 80% of its lifetime has elapsed.
+func tokenRotationTime(expiration time.Time, lifetime time.Duration) time.Time {
+	return expiration.Add(-lifetime / 5) //nolint:mnd
+}
@@ -0,0 +1,54 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// verifyKubeconfig verifies the kubeConfig of the ServiceAccount reaches the Capsule Proxy, and that its token
+// authenticates the ServiceAccount, issuing a SelfSubjectReview with it.
+// ErrProxyVerificationFailed is returned, along with the cause, when the verification fails.
+func (r *ServiceAccountReconciler) verifyKubeconfig(ctx context.Context, sa *corev1.ServiceAccount, config *clientcmdapi.Config) error {
+	restConfig, err := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
+	if err != nil {
+		return errors.Wrap(ErrProxyVerificationFailed, err.Error())
+	}
+
+	restConfig.Timeout = ProxyVerificationTimeout
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return errors.Wrap(ErrProxyVerificationFailed, err.Error())
+	}
+
+	review, err := clientset.AuthenticationV1().SelfSubjectReviews().Create(ctx, &authenticationv1.SelfSubjectReview{}, metav1.CreateOptions{})
+	if err != nil {
+		return errors.Wrap(ErrProxyVerificationFailed, err.Error())
+	}
+
+	if expected := serviceAccountUsername(sa.Namespace, sa.Name); review.Status.UserInfo.Username != expected {
+		return errors.Wrapf(ErrProxyVerificationFailed, "authenticated as %q instead of %q", review.Status.UserInfo.Username, expected)
+	}
+
+	return nil
+}
+
+// recordVerificationFailure logs the failed verification of the kubeConfig of the ServiceAccount, emitting an Event on
+// it.
+func (r *ServiceAccountReconciler) recordVerificationFailure(ctx context.Context, sa *corev1.ServiceAccount, err error) {
+	r.logger(ctx).Info("The kubeConfig verification against the Capsule Proxy failed", "error", err.Error())
+
+	if r.recorder != nil {
+		r.recorder.Event(sa, corev1.EventTypeWarning, ProxyVerificationFailedReason, err.Error())
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package serviceaccount
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newProxy returns a stand-in Capsule Proxy serving the SelfSubjectReviews, authenticating the tokens specified as
+// the users they are mapped to.
+func newProxy(t *testing.T, users map[string]string) *httptest.Server {
+	t.Helper()
+
+	proxy := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.URL.Path != "/apis/authentication.k8s.io/v1/selfsubjectreviews" {
+			http.NotFound(w, req)
+
+			return
+		}
+
+		username, ok := users[req.Header.Get("Authorization")]
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+
+			_ = json.NewEncoder(w).Encode(metav1.Status{
+				TypeMeta: metav1.TypeMeta{Kind: "Status", APIVersion: "v1"},
+				Status:   metav1.StatusFailure,
+				Reason:   metav1.StatusReasonUnauthorized,
+				Code:     http.StatusUnauthorized,
+			})
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+
+		_ = json.NewEncoder(w).Encode(authenticationv1.SelfSubjectReview{
+			TypeMeta: metav1.TypeMeta{Kind: "SelfSubjectReview", APIVersion: "authentication.k8s.io/v1"},
+			Status: authenticationv1.SelfSubjectReviewStatus{
+				UserInfo: authenticationv1.UserInfo{Username: username},
+			},
+		})
+	}))
+
+	// The handshakes failing on purpose are not logged.
+	proxy.Config.ErrorLog = log.New(io.Discard, "", 0)
+	proxy.StartTLS()
+
+	t.Cleanup(proxy.Close)
+
+	return proxy
+}
+
+func TestVerifyKubeconfig(t *testing.T) {
+	sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "oil-system", Name: "gitops-reconciler"}}
+
+	proxy := newProxy(t, map[string]string{
+		"Bearer valid": serviceAccountUsername(sa.Namespace, sa.Name),
+		"Bearer other": serviceAccountUsername(sa.Namespace, "other"),
+	})
+
+	proxyCA := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: proxy.Certificate().Raw}))
+
+	tests := []struct {
+		name    string
+		proxyCA string
+		token   string
+		valid   bool
+	}{
+		{name: "token authenticating the ServiceAccount", proxyCA: proxyCA, token: "valid", valid: true},
+		{name: "token authenticating another ServiceAccount", proxyCA: proxyCA, token: "other"},
+		{name: "token not authenticated", proxyCA: proxyCA, token: "invalid"},
+		{name: "Certificate Authority not matching", token: "valid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewServiceAccountReconciler(WithLogger(logr.Discard()), WithProxyCA(tt.proxyCA))
+
+			err := r.verifyKubeconfig(context.Background(), sa, r.buildKubeconfig(proxy.URL, tt.token))
+
+			switch {
+			case tt.valid && err != nil:
+				t.Fatalf("expected the kubeConfig to be verified, got %v", err)
+			case !tt.valid && !errors.Is(err, ErrProxyVerificationFailed):
+				t.Fatalf("expected %v, got %v", ErrProxyVerificationFailed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+
+	"github.com/projectcapsule/capsule-addon-flux/pkg/indexer"
+)
+
+// CheckTimeout is the timeout of the checks waiting for the cache.
+const CheckTimeout = time.Second
+
+// CacheSync returns a check passing once the informers of the cache are synced.
+func CacheSync(c cache.Cache) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), CheckTimeout)
+		defer cancel()
+
+		if !c.WaitForCacheSync(ctx) {
+			return errors.New("the informers cache is not synced")
+		}
+
+		return nil
+	}
+}
+
+// CRDs returns a check passing when the API server serves the kinds specified, such as the Capsule ones.
+func CRDs(mapper meta.RESTMapper, gvks ...schema.GroupVersionKind) healthz.Checker {
+	return func(_ *http.Request) error {
+		for _, gvk := range gvks {
+			if _, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+				return errors.Wrapf(err, "the %s API is not served", gvk.String())
+			}
+		}
+
+		return nil
+	}
+}
+
+// ProxyCA returns a check passing when the Certificate Authority used by Capsule Proxy, as loaded, holds only
+// certificates currently valid.
+func ProxyCA(proxyCA []byte) healthz.Checker {
+	return func(_ *http.Request) error {
+		now := time.Now()
+		count := 0
+
+		for rest := proxyCA; ; {
+			var block *pem.Block
+			if block, rest = pem.Decode(rest); block == nil {
+				break
+			}
+
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return errors.Wrap(err, "unable to parse the Capsule Proxy Certificate Authority")
+			}
+
+			if now.After(cert.NotAfter) {
+				return errors.Errorf("the Capsule Proxy Certificate Authority %q expired on %s", cert.Subject.CommonName, cert.NotAfter.Format(time.RFC3339))
+			}
+
+			if now.Before(cert.NotBefore) {
+				return errors.Errorf("the Capsule Proxy Certificate Authority %q is not valid before %s", cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339))
+			}
+
+			count++
+		}
+
+		if count == 0 {
+			return errors.New("no Capsule Proxy Certificate Authority loaded")
+		}
+
+		return nil
+	}
+}
+
+// Index returns a check passing when the index is registered in the cache, listing the objects by its field.
+func Index(reader client.Reader, idx indexer.CustomIndexer, list client.ObjectList) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), CheckTimeout)
+		defer cancel()
+
+		// The list is copied, since the checks can be served concurrently.
+		objs, ok := list.DeepCopyObject().(client.ObjectList)
+		if !ok {
+			return errors.Errorf("unexpected list type %T", list)
+		}
+
+		if err := reader.List(ctx, objs, client.MatchingFields{idx.Field(): ""}, client.Limit(1)); err != nil {
+			return errors.Wrapf(err, "the %s index is not available", idx.Field())
+		}
+
+		return nil
+	}
+}
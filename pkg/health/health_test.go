@@ -0,0 +1,153 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+	"github.com/projectcapsule/capsule-addon-flux/pkg/indexer"
+)
+
+// newCertificate returns the PEM-encoded self-signed certificate valid in the period specified.
+func newCertificate(t *testing.T, notBefore, notAfter time.Time) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "capsule-proxy-ca"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestProxyCA(t *testing.T) {
+	now := time.Now()
+
+	valid := newCertificate(t, now.Add(-time.Hour), now.Add(time.Hour))
+	expired := newCertificate(t, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	notYetValid := newCertificate(t, now.Add(time.Hour), now.Add(2*time.Hour))
+	privateKey := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")})
+	malformed := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("certificate")})
+
+	tests := []struct {
+		name    string
+		proxyCA []byte
+		err     string
+	}{
+		{name: "valid", proxyCA: valid},
+		{name: "valid bundle", proxyCA: append(append([]byte{}, valid...), privateKey...)},
+		{name: "not loaded", err: "no Capsule Proxy Certificate Authority loaded"},
+		{name: "not a certificate", proxyCA: privateKey, err: "no Capsule Proxy Certificate Authority loaded"},
+		{name: "malformed", proxyCA: malformed, err: "unable to parse"},
+		{name: "expired", proxyCA: expired, err: "expired"},
+		{name: "expired in bundle", proxyCA: append(append([]byte{}, valid...), expired...), err: "expired"},
+		{name: "not yet valid", proxyCA: notYetValid, err: "is not valid before"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ProxyCA(tt.proxyCA)(httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Fatalf("expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestCRDs(t *testing.T) {
+	tenant := schema.GroupVersionKind{Group: "capsule.clastix.io", Version: "v1beta2", Kind: "Tenant"}
+	tenantOwner := schema.GroupVersionKind{Group: "capsule.clastix.io", Version: "v1beta2", Kind: "TenantOwner"}
+	legacyTenant := schema.GroupVersionKind{Group: "capsule.clastix.io", Version: "v1beta1", Kind: "Tenant"}
+
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{tenant.GroupVersion()})
+	mapper.Add(tenant, meta.RESTScopeRoot)
+
+	tests := []struct {
+		name string
+		gvks []schema.GroupVersionKind
+		err  bool
+	}{
+		{name: "none"},
+		{name: "served", gvks: []schema.GroupVersionKind{tenant}},
+		{name: "kind not served", gvks: []schema.GroupVersionKind{tenant, tenantOwner}, err: true},
+		{name: "version not served", gvks: []schema.GroupVersionKind{legacyTenant}, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CRDs(mapper, tt.gvks...)(httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if (err != nil) != tt.err {
+				t.Fatalf("expected an error to be %t, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestIndex(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	idx := indexer.FluxTenantCredentialServiceAccount{}
+
+	tests := []struct {
+		name    string
+		indexed bool
+	}{
+		{name: "registered", indexed: true},
+		{name: "not registered"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+			if tt.indexed {
+				builder = builder.WithIndex(idx.Object(), idx.Field(), idx.Func())
+			}
+
+			err := Index(builder.Build(), idx, &v1alpha1.FluxTenantCredentialList{})(httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+			if (err == nil) != tt.indexed {
+				t.Fatalf("expected the index to be available %t, got %v", tt.indexed, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package indexer
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/projectcapsule/capsule-addon-flux/api/v1alpha1"
+)
+
+// FluxTenantCredentialServiceAccountField indexes the FluxTenantCredentials by the ServiceAccount they refer to.
+const FluxTenantCredentialServiceAccountField = ".spec.serviceAccountName"
+
+type FluxTenantCredentialServiceAccount struct{}
+
+func (FluxTenantCredentialServiceAccount) Object() client.Object {
+	return &v1alpha1.FluxTenantCredential{}
+}
+
+func (FluxTenantCredentialServiceAccount) Field() string {
+	return FluxTenantCredentialServiceAccountField
+}
+
+func (FluxTenantCredentialServiceAccount) Func() client.IndexerFunc {
+	return func(object client.Object) []string {
+		ftc, ok := object.(*v1alpha1.FluxTenantCredential)
+		if !ok {
+			panic(fmt.Errorf("expected type *v1alpha1.FluxTenantCredential, got %T", object))
+		}
+
+		return []string{ftc.Spec.ServiceAccountName}
+	}
+}
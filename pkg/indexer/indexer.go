@@ -10,18 +10,32 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/projectcapsule/capsule/pkg/indexer/tenant"
 	"github.com/projectcapsule/capsule/pkg/utils"
-	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/cluster"
 )
 
-func AddToManager(ctx context.Context, log logr.Logger, mgr manager.Manager) error {
-	indexer := tenant.OwnerReference{}
+type CustomIndexer interface {
+	Object() client.Object
+	Field() string
+	Func() client.IndexerFunc
+}
 
-	if err := mgr.GetFieldIndexer().IndexField(ctx, indexer.Object(), indexer.Field(), indexer.Func()); err != nil {
-		if utils.IsUnsupportedAPI(err) {
-			log.Info(fmt.Sprintf("skipping setup of Indexer %T for object %T", indexer, indexer.Object()), "error", err.Error())
-		}
+// AddToManager registers the indexers, along with the additional ones specified, such as the ones of the generated
+// objects.
+func AddToManager(ctx context.Context, log logr.Logger, mgr cluster.Cluster, additional ...CustomIndexer) error {
+	indexers := append([]CustomIndexer{
+		tenant.OwnerReference{},
+		FluxTenantCredentialServiceAccount{},
+	}, additional...)
 
-		return err
+	for _, indexer := range indexers {
+		if err := mgr.GetFieldIndexer().IndexField(ctx, indexer.Object(), indexer.Field(), indexer.Func()); err != nil {
+			if utils.IsUnsupportedAPI(err) {
+				log.Info(fmt.Sprintf("skipping setup of Indexer %T for object %T", indexer, indexer.Object()), "error", err.Error())
+			}
+
+			return err
+		}
 	}
 
 	return nil
@@ -0,0 +1,31 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// DriftCorrections counts the corrections of the generated objects drifted from the desired state, by kind.
+var DriftCorrections = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "capsule_addon_fluxcd_drift_corrections_total",
+	Help: "Number of the generated objects corrected after drifting from the desired state.",
+}, []string{"kind"})
+
+// ApplyConflicts counts the conflicts with other managers applying the generated objects, by kind.
+var ApplyConflicts = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "capsule_addon_fluxcd_apply_conflicts_total",
+	Help: "Number of the conflicts with other field managers applying the generated objects.",
+}, []string{"kind"})
+
+// BuildInfo reports the build of the running addon, with a constant value of 1.
+var BuildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "capsule_addon_fluxcd_build_info",
+	Help: "Build information of the running addon, with a constant value of 1.",
+}, []string{"version", "commit", "date", "go_version", "capsule_version"})
+
+func init() {
+	metrics.Registry.MustRegister(DriftCorrections, ApplyConflicts, BuildInfo)
+}
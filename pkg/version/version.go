@@ -0,0 +1,67 @@
+// Copyright 2020-2024 Project Capsule Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package version
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// capsuleModule is the module of the Capsule API compiled in.
+const capsuleModule = "github.com/projectcapsule/capsule"
+
+// Version, Commit and Date describe the build of the addon, set at build time.
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Date    = "unknown"
+)
+
+// Info is the build information of the addon.
+type Info struct {
+	Version        string `json:"version"`
+	Commit         string `json:"commit"`
+	Date           string `json:"date"`
+	GoVersion      string `json:"goVersion"`
+	CapsuleVersion string `json:"capsuleVersion"`
+}
+
+// String returns the build information in a single line.
+func (i Info) String() string {
+	return fmt.Sprintf("%s (commit %s, built %s, %s, Capsule API %s)", i.Version, i.Commit, i.Date, i.GoVersion, i.CapsuleVersion)
+}
+
+// Get returns the build information of the addon.
+func Get() Info {
+	return Info{
+		Version:        Version,
+		Commit:         Commit,
+		Date:           Date,
+		GoVersion:      runtime.Version(),
+		CapsuleVersion: capsuleVersion(),
+	}
+}
+
+// capsuleVersion returns the version of the Capsule API module compiled in.
+func capsuleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+
+	for _, dep := range info.Deps {
+		if dep.Path != capsuleModule {
+			continue
+		}
+
+		if dep.Replace != nil {
+			return dep.Replace.Version
+		}
+
+		return dep.Version
+	}
+
+	return "unknown"
+}